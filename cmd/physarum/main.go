@@ -1,9 +1,7 @@
 package main
 
 import (
-	"math/rand"
 	_ "net/http/pprof"
-	"time"
 
 	"github.com/droidicus/physarum/pkg/physarum"
 )
@@ -13,7 +11,5 @@ func main() {
 	// 	log.Println(http.ListenAndServe("localhost:6060", nil))
 	// }()
 
-	rand.Seed(time.Now().UTC().UnixNano())
-
 	physarum.Run()
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"math"
 	"math/rand"
@@ -29,14 +30,59 @@ func main() {
 
 	// Command line options
 	settingsFilePtr := flag.String("settings", "", "Location of a json file to use for settings to run the simulation")
+	checkpointFilePtr := flag.String("checkpoint", "", "Location of a checkpoint file to resume the simulation from")
 	flag.Parse()
 
-	// Read settings if they are given, and write them to record complete settings
+	// Read settings if they are given
 	settings := physarum.NewSettings(*settingsFilePtr)
+
+	// Resume from a checkpoint if given, the model it holds overrides the simulation settings
+	var resumed *physarum.Model
+	if *checkpointFilePtr != "" {
+		var err error
+		resumed, err = physarum.LoadCheckpointFile(*checkpointFilePtr)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		settings.Width = resumed.W
+		settings.Height = resumed.H
+		settings.Particles = resumed.Particles.Len()
+		settings.BlurRadius = resumed.BlurRadius
+		settings.BlurPasses = resumed.BlurPasses
+		settings.ZoomFactor = resumed.ZoomFactor
+		settings.Configs = resumed.Configs
+		settings.AttractionTable = resumed.AttractionTable
+		settings.InitType = resumed.InitType
+		settings.Boundary = resumed.Boundary
+		settings.ObstacleMask = resumed.ObstacleMask
+		if resumed.Obstacles != nil && resumed.ObstacleMask == "" {
+			log.Println("the checkpoint does not say where its walls came from, restarts will have none")
+		}
+		settings.Seed = resumed.Seed()
+		settings.Food = resumed.Food
+		settings.Deterministic = resumed.Deterministic
+		settings.MaxParticles = resumed.MaxParticles
+		settings.ConversionTable = resumed.ConversionTable
+		settings.ConversionThreshold = resumed.ConversionThreshold
+		settings.Timeline = resumed.Keyframes
+		settings.BlurKernel = resumed.BlurKernel
+		settings.BlurSigma = resumed.BlurSigma
+		settings.DiffusionRate = resumed.DiffusionRate
+		settings.BlurRadiusX = resumed.BlurRadiusX
+		settings.BlurRadiusY = resumed.BlurRadiusY
+		settings.Interpolation = resumed.Interpolation
+		settings.Exclusion = resumed.Exclusion
+		settings.Flow = resumed.Flow
+		settings.CompactAngles = resumed.Particles.CompactAngles()
+		settings.GridPrecision = resumed.GridPrecision
+		settings.FusedSensing = resumed.FusedSensing
+	}
+
+	// Write settings to record complete settings
 	settings.WriteSettingsToFile()
 
-	// Reset the seed
-	rand.Seed(settings.Seed)
+	// Random source for the palette controls
+	rnd := rand.New(rand.NewSource(settings.Seed))
 
 	// initialize glfw
 	if err := glfw.Init(); err != nil {
@@ -68,9 +114,13 @@ func main() {
 
 	// Function that runs whenever we want to reset the simulation, and run it now
 	reset := func() {
-		model = physarum.MakeModel(settings)
+		if resumed != nil {
+			model, resumed = resumed, nil
+		} else {
+			model = physarum.MakeModel(settings)
+		}
 		texture.Init(len(model.Configs), settings.Width, settings.Height, settings.Particles)
-		texture.Update(model.Data())
+		texture.Update(model.CopySnapshot().Data)
 		texture.SetPalette(settings.Palette, settings.Gamma)
 	}
 	reset()
@@ -90,12 +140,12 @@ func main() {
 			case glfw.KeySpace:
 				reset()
 			case glfw.KeyA:
-				texture.AutoLevel(model.Data(), 0.001, 0.999)
+				texture.AutoLevel(model.CopySnapshot().Data, 0.001, 0.999)
 			case glfw.KeyO:
 				// TODO: this is not currently saved in settings
-				texture.ShufflePalette()
+				texture.ShufflePalette(rnd)
 			case glfw.KeyP:
-				settings.Palette = physarum.RandomPalette()
+				settings.Palette = physarum.RandomPalette(rnd)
 				texture.SetPalette(settings.Palette, settings.Gamma)
 			case glfw.KeyR:
 				model.StartOver()
@@ -104,6 +154,13 @@ func main() {
 				if err != nil {
 					log.Println("Error writing settings to file!", err)
 				}
+			case glfw.KeyC:
+				path := fmt.Sprintf("%s_%08d.checkpoint", settings.GetFilePathWOExtension(), model.Iteration)
+				if err := model.SaveCheckpointFile(path); err != nil {
+					log.Println("Error writing checkpoint to file!", err)
+				} else {
+					log.Println("Wrote checkpoint", path)
+				}
 			case glfw.Key1:
 				setInitType("random")
 			case glfw.Key2:
@@ -143,26 +200,37 @@ func main() {
 	// Record start time
 	start := time.Now()
 
+	// Signals that the steps of a frame are done
+	stepped := make(chan bool)
+
 	// Until the window needs closing
 	for !window.ShouldClose() {
 		gl.Clear(gl.COLOR_BUFFER_BIT)
-		for i := 0; i < settings.StepsPerFrame; i++ {
-			// Step model at desired rate
-			model.Step()
-		}
+
+		// Draw the last steps while the model takes the next ones
+		snapshot := model.CopySnapshot()
+		go func() {
+			for i := 0; i < settings.StepsPerFrame; i++ {
+				// Step model at desired rate
+				model.Step()
+			}
+			stepped <- true
+		}()
 		if saveVideo {
 			// Send a copy of the framebuffer for rendering into video if required
 			videoFameChan <- texture.GetFramebufferCopy()
 
 			// End if we have the desired number of frames
 			if (settings.MaxSteps > 0) && (video.FrameCount >= settings.MaxSteps-1) {
+				<-stepped
 				break
 			}
 		}
 
-		// Display image and manage interface
-		texture.Draw(window, model.Data())
+		// Display image, and only manage the interface once the model is done stepping
+		texture.Draw(window, snapshot.Data)
 		window.SwapBuffers()
+		<-stepped
 		glfw.PollEvents()
 	}
 
@@ -166,123 +166,246 @@ func boxBlurV(src, dst []float32, w, h, r int, scale float32) {
 	}
 }
 
-func threadedBoxBlurH(src, dst []float32, w, h, r int, scale float32) {
-	// waitgroup for threads
-	var wg sync.WaitGroup
-
-	m := scale / float32(r+r+1)
-	ww := w - (r*2 + 1)
-	for i := 0; i < h; i++ {
-		// New thread to wait on
-		wg.Add(1)
+// Read cell k of a line of n cells starting at off, spaced stride apart, with
+// cells past either end of the line treated according to the edge mode
+func edgeAt(src []float32, off, stride, n, k int, edge edgeMode) float32 {
+	if edge == edgeWrap {
+		k %= n
+		if k < 0 {
+			k += n
+		}
+	} else if k < 0 {
+		if edge == edgeZero {
+			return 0
+		}
+		k = 0
+	} else if k >= n {
+		if edge == edgeZero {
+			return 0
+		}
+		k = n - 1
+	}
+	return src[off+k*stride]
+}
 
-		go func(i int) {
-			// Defer
-			defer wg.Done()
+// Running sum box blur along a single line that does not wrap around at its ends
+func edgeBoxBlurLine(src, dst []float32, off, stride, n, r int, m float32, edge edgeMode) {
+	var val float32
+	for k := -r; k <= r; k++ {
+		val += edgeAt(src, off, stride, n, k, edge)
+	}
+	for k := 0; k < n; k++ {
+		dst[off+k*stride] = val * m
+		val += edgeAt(src, off, stride, n, k+r+1, edge) - edgeAt(src, off, stride, n, k-r, edge)
+	}
+}
 
-			// Do parallel loops
-			ti := i * w
-			li := ti + w - 1 - r
-			ri := ti + r
-			val := src[li]
-			for j := 0; j < r; j++ {
-				val += src[li+j+1]
-				val += src[ti+j]
-			}
-			for j := 0; j <= r; j++ {
-				val += src[ri] - src[li]
-				dst[ti] = val * m
-				li++
-				ri++
-				ti++
-			}
-			li = i * w
-			for j := 0; j < ww; j++ {
-				val += src[ri] - src[li]
-				dst[ti] = val * m
-				li++
-				ri++
-				ti++
-			}
-			ri = i * w
-			for j := 0; j < r; j++ {
-				val += src[ri] - src[li]
-				dst[ti] = val * m
-				li++
-				ri++
-				ti++
+func slowEdgeBoxBlurH(src, dst []float32, w, h, r int, scale float32, edge edgeMode) {
+	m := scale / float32(r+r+1)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var val float32
+			for k := -r; k <= r; k++ {
+				val += edgeAt(src, y*w, 1, w, x+k, edge)
 			}
-		}(i)
+			dst[y*w+x] = val * m
+		}
 	}
+}
 
-	// Wait for the threads to finish
-	wg.Wait()
+func slowEdgeBoxBlurV(src, dst []float32, w, h, r int, scale float32, edge edgeMode) {
+	m := scale / float32(r+r+1)
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			var val float32
+			for k := -r; k <= r; k++ {
+				val += edgeAt(src, x, w, h, y+k, edge)
+			}
+			dst[y*w+x] = val * m
+		}
+	}
 }
 
-func threadedBoxBlurV(src, dst []float32, w, h, r int, scale float32) {
-	// waitgroup for threads
-	var wg sync.WaitGroup
+// Blurs a stretch of open cells, those before its start read according to lo
+// and those past its end according to hi
+type stretchBlur func(in, out []float32, lo, hi edgeMode)
 
-	m := scale / float32(r+r+1)
-	hh := h - (r*2 + 1)
-	for i := 0; i < w; i++ {
-		// New thread to wait on
-		wg.Add(1)
+// Cell k of a stretch of open cells, read like edgeAt with its own mode for each end
+func stretchAt(in []float32, k int, lo, hi edgeMode) float32 {
+	n := len(in)
+	mode := lo
+	if k >= n {
+		mode = hi
+	} else if k >= 0 {
+		return in[k]
+	}
+	switch mode {
+	case edgeWrap:
+		k %= n
+		if k < 0 {
+			k += n
+		}
+		return in[k]
+	case edgeZero:
+		return 0
+	}
+	if k < 0 {
+		return in[0]
+	}
+	return in[n-1]
+}
 
-		go func(i int) {
-			// Defer
-			defer wg.Done()
+// Running sum box blur of radius r over a stretch, times m
+func boxStretch(r int, m float32) stretchBlur {
+	return func(in, out []float32, lo, hi edgeMode) {
+		var val float32
+		for k := -r; k <= r; k++ {
+			val += stretchAt(in, k, lo, hi)
+		}
+		for k := range in {
+			out[k] = val * m
+			val += stretchAt(in, k+r+1, lo, hi) - stretchAt(in, k-r, lo, hi)
+		}
+	}
+}
 
-			// Do parallel loops
-			ti := i
-			li := ti + (h-1-r)*w
-			ri := ti + r*w
-			val := src[li]
-			for j := 0; j < r; j++ {
-				val += src[li+(j+1)*w]
-				val += src[ti+j*w]
+// Blur every stretch of open cells of the line of n cells starting at off,
+// spaced stride apart, on its own, so no trail crosses a wall. Stretches are
+// clamped where they end at a wall, like at a reflective edge, and read
+// according to the edge mode where they end at the edge of the grid. The walls
+// themselves are cleared. buf and out hold at least n cells.
+func wallLine(src, dst []float32, off, stride, n int, walls []bool, edge edgeMode, buf, out []float32, blur stretchBlur) {
+	// With wrapping edges the line is a loop, go around it from just past a wall
+	start := 0
+	if edge == edgeWrap {
+		start = -1
+		for k := 0; k < n; k++ {
+			if walls[off+k*stride] {
+				start = k + 1
+				break
 			}
-			for j := 0; j <= r; j++ {
-				val += src[ri] - src[li]
-				dst[ti] = val * m
-				li += w
-				ri += w
-				ti += w
+		}
+		if start < 0 {
+			for k := 0; k < n; k++ {
+				buf[k] = src[off+k*stride]
 			}
-			li = i
-			for j := 0; j < hh; j++ {
-				val += src[ri] - src[li]
-				dst[ti] = val * m
-				li += w
-				ri += w
-				ti += w
+			blur(buf[:n], out[:n], edgeWrap, edgeWrap)
+			for k := 0; k < n; k++ {
+				dst[off+k*stride] = out[k]
+			}
+			return
+		}
+	}
+
+	length := 0
+	flush := func(end int) {
+		if length == 0 {
+			return
+		}
+		lo, hi := edgeClamp, edgeClamp
+		if edge != edgeWrap {
+			if end == length {
+				lo = edge
 			}
-			ri = i
-			for j := 0; j < r; j++ {
-				val += src[ri] - src[li]
-				dst[ti] = val * m
-				li += w
-				ri += w
-				ti += w
+			if end == n {
+				hi = edge
 			}
-		}(i)
+		}
+		blur(buf[:length], out[:length], lo, hi)
+		for j := 0; j < length; j++ {
+			k := (start + end - length + j) % n
+			dst[off+k*stride] = out[j]
+		}
+		length = 0
 	}
+	for v := 0; v < n; v++ {
+		i := off + (start+v)%n*stride
+		if walls[i] {
+			flush(v)
+			dst[i] = 0
+			continue
+		}
+		buf[length] = src[i]
+		length++
+	}
+	flush(n)
+}
 
-	// Wait for the threads to finish
-	wg.Wait()
+// Blur the rows of src into tmp with blurH, and the columns of tmp back into
+// src with blurV, along the open stretches between the walls
+func wallBlur(src, tmp []float32, w, h int, walls []bool, edge edgeMode, blurH, blurV stretchBlur) {
+	parallelRows(h, func(y0, y1 int) {
+		buf, out := make([]float32, w), make([]float32, w)
+		for y := y0; y < y1; y++ {
+			wallLine(src, tmp, y*w, 1, w, walls, edge, buf, out, blurH)
+		}
+	})
+	// The same tiling works for columns
+	parallelRows(w, func(x0, x1 int) {
+		buf, out := make([]float32, h), make([]float32, h)
+		for x := x0; x < x1; x++ {
+			wallLine(tmp, src, x, w, h, walls, edge, buf, out, blurV)
+		}
+	})
 }
 
-func boxBlur(src, tmp []float32, w, h, r int, scale float32) {
-	// TODO: Are these the same or different? If different, add to settings
-	// boxBlurH(src, tmp, w, h, r, 1)
-	// boxBlurV(tmp, src, w, h, r, scale)
+// Running sum box blur along a row of w cells starting at start, that wraps
+// around at its ends, the kernel needs to fit inside the row
+func boxBlurRow(src, dst []float32, start, w, r int, m float32) {
+	ti := start
+	li := ti + w - 1 - r
+	ri := ti + r
+	val := src[li]
+	for j := 0; j < r; j++ {
+		val += src[li+j+1]
+		val += src[ti+j]
+	}
+	for j := 0; j <= r; j++ {
+		val += src[ri] - src[li]
+		dst[ti] = val * m
+		li++
+		ri++
+		ti++
+	}
+	li = start
+	for j := 0; j < w-(r*2+1); j++ {
+		val += src[ri] - src[li]
+		dst[ti] = val * m
+		li++
+		ri++
+		ti++
+	}
+	ri = start
+	for j := 0; j < r; j++ {
+		val += src[ri] - src[li]
+		dst[ti] = val * m
+		li++
+		ri++
+		ti++
+	}
+}
 
-	threadedBoxBlurH(src, tmp, w, h, r, 1)
-	threadedBoxBlurV(tmp, src, w, h, r, scale)
+// Horizontal box blur on tiles of rows run by the shared worker pool
+func pooledBoxBlurH(src, dst []float32, w, h, r int, scale float32, edge edgeMode) {
+	m := scale / float32(r+r+1)
+	parallelRows(h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			if edge == edgeWrap && w >= r+r+1 {
+				boxBlurRow(src, dst, y*w, w, r, m)
+			} else {
+				edgeBoxBlurLine(src, dst, y*w, 1, w, r, m, edge)
+			}
+		}
+	})
+}
 
-	// slowBoxBlurH(src, tmp, w, h, r, 1)
-	// slowBoxBlurV(tmp, src, w, h, r, scale)
+// Box blur with horizontal radius rx and vertical radius ry
+func boxBlur(src, tmp []float32, w, h, rx, ry int, scale float32, edge edgeMode) {
+	pooledBoxBlurH(src, tmp, w, h, rx, 1, edge)
 
-	// slowThreadedBoxBlurH(src, tmp, w, h, r, 1)
-	// slowThreadedBoxBlurV(tmp, src, w, h, r, scale)
+	// The vertical pass is a horizontal one over the transposed grid, which
+	// reads memory in order instead of jumping a whole row for every cell
+	transpose(tmp, src, w, h)
+	pooledBoxBlurH(src, tmp, h, w, ry, scale, edge)
+	transpose(tmp, src, h, w)
 }
@@ -1,6 +1,8 @@
 package physarum
 
 import (
+	"math"
+	"sync"
 	"testing"
 )
 
@@ -201,6 +203,114 @@ func TestSlowThreadedBoxBlurV(t *testing.T) {
 	}
 }
 
+// The goroutine per row and column kernels that the pooled blur replaced, kept
+// to test and benchmark it against
+func threadedBoxBlurH(src, dst []float32, w, h, r int, scale float32) {
+	// waitgroup for threads
+	var wg sync.WaitGroup
+
+	m := scale / float32(r+r+1)
+	ww := w - (r*2 + 1)
+	for i := 0; i < h; i++ {
+		// New thread to wait on
+		wg.Add(1)
+
+		go func(i int) {
+			// Defer
+			defer wg.Done()
+
+			// Do parallel loops
+			ti := i * w
+			li := ti + w - 1 - r
+			ri := ti + r
+			val := src[li]
+			for j := 0; j < r; j++ {
+				val += src[li+j+1]
+				val += src[ti+j]
+			}
+			for j := 0; j <= r; j++ {
+				val += src[ri] - src[li]
+				dst[ti] = val * m
+				li++
+				ri++
+				ti++
+			}
+			li = i * w
+			for j := 0; j < ww; j++ {
+				val += src[ri] - src[li]
+				dst[ti] = val * m
+				li++
+				ri++
+				ti++
+			}
+			ri = i * w
+			for j := 0; j < r; j++ {
+				val += src[ri] - src[li]
+				dst[ti] = val * m
+				li++
+				ri++
+				ti++
+			}
+		}(i)
+	}
+
+	// Wait for the threads to finish
+	wg.Wait()
+}
+
+func threadedBoxBlurV(src, dst []float32, w, h, r int, scale float32) {
+	// waitgroup for threads
+	var wg sync.WaitGroup
+
+	m := scale / float32(r+r+1)
+	hh := h - (r*2 + 1)
+	for i := 0; i < w; i++ {
+		// New thread to wait on
+		wg.Add(1)
+
+		go func(i int) {
+			// Defer
+			defer wg.Done()
+
+			// Do parallel loops
+			ti := i
+			li := ti + (h-1-r)*w
+			ri := ti + r*w
+			val := src[li]
+			for j := 0; j < r; j++ {
+				val += src[li+(j+1)*w]
+				val += src[ti+j*w]
+			}
+			for j := 0; j <= r; j++ {
+				val += src[ri] - src[li]
+				dst[ti] = val * m
+				li += w
+				ri += w
+				ti += w
+			}
+			li = i
+			for j := 0; j < hh; j++ {
+				val += src[ri] - src[li]
+				dst[ti] = val * m
+				li += w
+				ri += w
+				ti += w
+			}
+			ri = i
+			for j := 0; j < r; j++ {
+				val += src[ri] - src[li]
+				dst[ti] = val * m
+				li += w
+				ri += w
+				ti += w
+			}
+		}(i)
+	}
+
+	// Wait for the threads to finish
+	wg.Wait()
+}
+
 func BenchmarkThreadedBoxBlurH(b *testing.B) {
 	// Setup
 	w := 1024
@@ -278,3 +388,154 @@ func TestThreadedBoxBlurV(t *testing.T) {
 		}
 	}
 }
+
+func TestPooledBoxBlurH(t *testing.T) {
+	w := 1024
+	h := 1024
+	src := make([]float32, w*h)
+	dst1 := make([]float32, w*h)
+	dst2 := make([]float32, w*h)
+	for i := range src {
+		src[i] = float32(i)
+	}
+	for r := 0; r < 5; r++ {
+		pooledBoxBlurH(src, dst1, w, h, r, 1, edgeWrap)
+		slowBoxBlurH(src, dst2, w, h, r, 1)
+		for i := range src {
+			if dst1[i] != dst2[i] {
+				t.Fatalf("got %v, want %v", dst1, dst2)
+			}
+		}
+	}
+}
+
+func TestPooledEdgeBoxBlurH(t *testing.T) {
+	w := 1024
+	h := 1024
+	src := make([]float32, w*h)
+	dst1 := make([]float32, w*h)
+	dst2 := make([]float32, w*h)
+	for i := range src {
+		src[i] = float32(i)
+	}
+	for _, edge := range []edgeMode{edgeClamp, edgeZero} {
+		for r := 0; r < 5; r++ {
+			pooledBoxBlurH(src, dst1, w, h, r, 1, edge)
+			slowEdgeBoxBlurH(src, dst2, w, h, r, 1, edge)
+			for i := range src {
+				if dst1[i] != dst2[i] {
+					t.Fatalf("edge %v, r %v: got %v, want %v at %v", edge, r, dst1[i], dst2[i], i)
+				}
+			}
+		}
+	}
+}
+
+func TestBoxBlurNonPowerOfTwo(t *testing.T) {
+	w := 480
+	h := 270
+	src := make([]float32, w*h)
+	dst1 := make([]float32, w*h)
+	dst2 := make([]float32, w*h)
+	for i := range src {
+		src[i] = float32(i)
+	}
+	for r := 0; r < 5; r++ {
+		threadedBoxBlurH(src, dst1, w, h, r, 1)
+		slowBoxBlurH(src, dst2, w, h, r, 1)
+		for i := range src {
+			if dst1[i] != dst2[i] {
+				t.Fatalf("H r %v: got %v, want %v at %v", r, dst1[i], dst2[i], i)
+			}
+		}
+		threadedBoxBlurV(src, dst1, w, h, r, 1)
+		slowBoxBlurV(src, dst2, w, h, r, 1)
+		for i := range src {
+			if dst1[i] != dst2[i] {
+				t.Fatalf("V r %v: got %v, want %v at %v", r, dst1[i], dst2[i], i)
+			}
+		}
+	}
+}
+
+func TestPooledBoxBlur(t *testing.T) {
+	for _, size := range [][2]int{{1024, 512}, {480, 270}, {7, 5}} {
+		w, h := size[0], size[1]
+		for _, edge := range []edgeMode{edgeWrap, edgeClamp, edgeZero} {
+			for r := 0; r < 5; r++ {
+				src1 := make([]float32, w*h)
+				src2 := make([]float32, w*h)
+				tmp := make([]float32, w*h)
+				for i := range src1 {
+					src1[i] = float32(i % 1013)
+					src2[i] = src1[i]
+				}
+				boxBlur(src1, tmp, w, h, r, r, 0.5, edge)
+				slowEdgeBoxBlurH(src2, tmp, w, h, r, 1, edge)
+				slowEdgeBoxBlurV(tmp, src2, w, h, r, 0.5, edge)
+				for i := range src1 {
+					// The running sums add the cells in another order than the slow blur
+					if math.Abs(float64(src1[i]-src2[i])) > 1e-3 {
+						t.Fatalf("%dx%d edge %v, r %v: got %v, want %v at %v", w, h, edge, r, src1[i], src2[i], i)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestTranspose(t *testing.T) {
+	w, h := 70, 45
+	src := make([]float32, w*h)
+	dst := make([]float32, w*h)
+	for i := range src {
+		src[i] = float32(i)
+	}
+	transpose(src, dst, w, h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if dst[x*h+y] != src[y*w+x] {
+				t.Fatalf("%d, %d: got %v, want %v", x, y, dst[x*h+y], src[y*w+x])
+			}
+		}
+	}
+}
+
+func BenchmarkThreadedBoxBlur(b *testing.B) {
+	// Setup
+	w := 4096
+	h := 2048
+	src := make([]float32, w*h)
+	tmp := make([]float32, w*h)
+
+	// Init with some data
+	for i := range src {
+		src[i] = float32(i)
+	}
+
+	// Run the blur benchmark, the goroutine per row and column kernels
+	for i := 0; i < b.N; i++ {
+		threadedBoxBlurH(src, tmp, w, h, 1, 1)
+		threadedBoxBlurV(tmp, src, w, h, 1, 1)
+	}
+	result = src
+}
+
+func BenchmarkPooledBoxBlur(b *testing.B) {
+	// Setup
+	w := 4096
+	h := 2048
+	src := make([]float32, w*h)
+	tmp := make([]float32, w*h)
+
+	// Init with some data
+	for i := range src {
+		src[i] = float32(i)
+	}
+
+	// Run the blur benchmark, row tiles on the worker pool and a tiled transpose
+	for i := 0; i < b.N; i++ {
+		boxBlur(src, tmp, w, h, 1, 1, 1, edgeWrap)
+	}
+	result = src
+}
@@ -0,0 +1,66 @@
+package physarum
+
+import (
+	"log"
+	"math"
+)
+
+// All the supported boundary conditions
+const (
+	Toroidal   = "toroidal"   // Edges wrap around, the world is a torus
+	Reflective = "reflective" // Particles bounce off the edges, sensors clamp to the edge
+	Absorbing  = "absorbing"  // Particles leaving the grid respawn, trail is lost at the edges
+)
+
+// All of the supported boundary conditions in a slice
+var AllBoundaries = [...]string{
+	Toroidal,
+	Reflective,
+	Absorbing,
+}
+
+// edgeMode is how grid lookups and the blur treat cells outside of the grid
+type edgeMode uint8
+
+const (
+	edgeWrap  edgeMode = iota // Wrap around to the other side
+	edgeClamp                 // Repeat the nearest edge cell
+	edgeZero                  // Read as zero
+)
+
+func boundaryEdgeMode(boundary string) edgeMode {
+	switch boundary {
+	case Toroidal, "":
+		return edgeWrap
+	case Reflective:
+		return edgeClamp
+	case Absorbing:
+		return edgeZero
+	}
+	log.Fatalf("unknown boundary %q", boundary)
+	return edgeWrap
+}
+
+// Bounce a particle that stepped outside of a w x h grid back inside, mirroring its heading
+func bounce(x, y, a, w, h float32) (float32, float32, float32) {
+	if x < 0 {
+		x = -x
+		a = math.Pi - a
+	} else if x >= w {
+		x = 2*w - x
+		a = math.Pi - a
+	}
+	if y < 0 {
+		y = -y
+		a = -a
+	} else if y >= h {
+		y = 2*h - y
+		a = -a
+	}
+
+	// Very large steps on tiny grids can still overshoot, and a particle right
+	// on the far edge stays there, just stop inside the edge
+	x = float32(math.Min(math.Max(float64(x), 0), float64(math.Nextafter32(w, 0))))
+	y = float32(math.Min(math.Max(float64(y), 0), float64(math.Nextafter32(h, 0))))
+	return x, y, Shift(a, 2*math.Pi)
+}
@@ -0,0 +1,52 @@
+package physarum
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestBounce(t *testing.T) {
+	below := math.Nextafter32(10, 0)
+	for _, test := range []struct {
+		name    string
+		x, y, a float32
+		want    [3]float32
+	}{
+		{"left", -1, 5, 0, [3]float32{1, 5, math.Pi}},
+		{"right", 10.5, 5, 0.25, [3]float32{9.5, 5, math.Pi - 0.25}},
+		{"top", 5, -2, math.Pi / 2, [3]float32{5, 2, 3 * math.Pi / 2}},
+		{"bottom", 5, 11, math.Pi / 2, [3]float32{5, 9, 3 * math.Pi / 2}},
+		{"corner", -1, -1, 5 * math.Pi / 4, [3]float32{1, 1, math.Pi / 4}},
+		{"far corner", 10.5, 11, math.Pi / 4, [3]float32{9.5, 9, 5 * math.Pi / 4}},
+		{"overshoot", -25, 5, 0, [3]float32{below, 5, math.Pi}},
+		{"on the edge", 10, 5, 0, [3]float32{below, 5, math.Pi}},
+	} {
+		x, y, a := bounce(test.x, test.y, test.a, 10, 10)
+		if x != test.want[0] || y != test.want[1] || math.Abs(float64(a-test.want[2])) > 1e-5 {
+			t.Errorf("%s: got %v, %v, %v, want %v", test.name, x, y, a, test.want)
+		}
+	}
+}
+
+func TestBoundariesKeepParticlesInside(t *testing.T) {
+	for _, boundary := range []string{Reflective, Absorbing} {
+		rnd := rand.New(rand.NewSource(1))
+		configs := RandomConfigs(rnd, 2)
+		for c := range configs {
+			configs[c].StepDistance = 7 // Most steps from near an edge leave the grid
+		}
+		m := NewModel(16, 12, 500, 1, 1, 1, configs, RandomAttractionTable(rnd, 2), Random, boundary, nil, 1)
+		for i := 0; i < 20; i++ {
+			m.Step()
+			for k, p := range allParticles(m) {
+				if p.X < 0 || p.X >= 16 || p.Y < 0 || p.Y >= 12 {
+					t.Fatalf("%s, step %d: particle %d is outside at %v, %v", boundary, i, k, p.X, p.Y)
+				}
+			}
+		}
+		if n := m.Particles.Len(); n != 500 {
+			t.Fatalf("%s: got %d particles, want 500", boundary, n)
+		}
+	}
+}
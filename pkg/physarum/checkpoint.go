@@ -0,0 +1,463 @@
+package physarum
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// Checkpoint layout, all numbers little endian:
+//
+//	magic      [4]byte "PHYC"
+//	version    uint32
+//	header     uint32 length, then that many bytes of JSON (checkpointHeader)
+//	walls      one bit per cell, only if the header says there are obstacles
+//	food       per food source: uint32 count, then count (uint32 cell, float32 weight) pairs
+//	particles  16 bytes each: X, Y, A float32 and C uint32
+//	grids      W*H float32 per species
+const (
+	checkpointMagic   = "PHYC"
+	checkpointVersion = 1
+
+	// Limits on what a checkpoint may ask for, so a corrupt file can not make
+	// the loader allocate without end
+	maxCheckpointHeader    = 64 << 20
+	maxCheckpointParticles = 1 << 28
+	maxCheckpointCells     = 1 << 28 // Cells of all the grids together
+)
+
+// Everything about a model that is not bulk data
+type checkpointHeader struct {
+	W               int
+	H               int
+	BlurRadius      int
+	BlurPasses      int
+	ZoomFactor      float32
+	Configs         []Config
+	AttractionTable [][]float32
+	Iteration       int
+	InitType        string
+	Boundary        string
+	Seed            int64
+	Deterministic   bool
+	Food            []FoodSource
+	Obstacles       bool
+	ObstacleMask    string
+	NumParticles    int
+	TotalParticles  int
+	MaxParticles    int
+
+	ConversionTable     [][]float32
+	ConversionThreshold float32
+
+	Keyframes []Keyframe
+
+	BlurKernel    string
+	BlurSigma     float32
+	DiffusionRate float32
+	BlurRadiusX   int
+	BlurRadiusY   int
+
+	Interpolation string
+	Exclusion     bool
+
+	Flow Flow
+
+	CompactAngles bool
+
+	GridPrecision string
+	FusedSensing  bool
+}
+
+// Write the complete state of the simulation so it can be resumed later with LoadCheckpoint
+func (m *Model) SaveCheckpoint(writer io.Writer) error {
+	w := bufio.NewWriter(writer)
+
+	header, err := json.Marshal(checkpointHeader{
+		W:               m.W,
+		H:               m.H,
+		BlurRadius:      m.BlurRadius,
+		BlurPasses:      m.BlurPasses,
+		ZoomFactor:      m.ZoomFactor,
+		Configs:         m.Configs,
+		AttractionTable: m.AttractionTable,
+		Iteration:       m.Iteration,
+		InitType:        m.InitType,
+		Boundary:        m.Boundary,
+		Seed:            m.seed,
+		Deterministic:   m.Deterministic,
+		Food:            m.Food,
+		Obstacles:       m.Obstacles != nil,
+		ObstacleMask:    m.ObstacleMask,
+		NumParticles:    m.Particles.Len(),
+		TotalParticles:  m.numParticles,
+		MaxParticles:    m.MaxParticles,
+
+		ConversionTable:     m.ConversionTable,
+		ConversionThreshold: m.ConversionThreshold,
+
+		Keyframes: m.Keyframes,
+
+		BlurKernel:    m.BlurKernel,
+		BlurSigma:     m.BlurSigma,
+		DiffusionRate: m.DiffusionRate,
+		BlurRadiusX:   m.BlurRadiusX,
+		BlurRadiusY:   m.BlurRadiusY,
+
+		Interpolation: m.Interpolation,
+		Exclusion:     m.Exclusion,
+
+		Flow: m.Flow,
+
+		CompactAngles: m.Particles.CompactAngles(),
+
+		GridPrecision: m.GridPrecision,
+		FusedSensing:  m.FusedSensing,
+	})
+	if err != nil {
+		return err
+	}
+	w.WriteString(checkpointMagic)
+	writeUint32(w, checkpointVersion)
+	writeUint32(w, uint32(len(header)))
+	w.Write(header)
+
+	if m.Obstacles != nil {
+		bits := make([]byte, (len(m.Obstacles)+7)/8)
+		for i, wall := range m.Obstacles {
+			if wall {
+				bits[i/8] |= 1 << (i % 8)
+			}
+		}
+		w.Write(bits)
+	}
+
+	for _, f := range m.food {
+		writeUint32(w, uint32(len(f.cells)))
+		for k, i := range f.cells {
+			writeUint32(w, uint32(i))
+			writeUint32(w, math.Float32bits(f.weights[k]))
+		}
+	}
+
+	var buf [16]byte
+	for i := 0; i < m.Particles.Len(); i++ {
+		p := m.Particles.At(i)
+		binary.LittleEndian.PutUint32(buf[0:], math.Float32bits(p.X))
+		binary.LittleEndian.PutUint32(buf[4:], math.Float32bits(p.Y))
+		binary.LittleEndian.PutUint32(buf[8:], math.Float32bits(p.A))
+		binary.LittleEndian.PutUint32(buf[12:], p.C)
+		w.Write(buf[:])
+	}
+
+	for _, grid := range m.Grids {
+		for i := 0; i < grid.W*grid.H; i++ {
+			writeUint32(w, math.Float32bits(grid.dataAt(i)))
+		}
+	}
+
+	// bufio.Writer remembers the first error, so it is enough to check here
+	return w.Flush()
+}
+
+// Read a model written by SaveCheckpoint, ready to continue stepping where it left off
+func LoadCheckpoint(reader io.Reader) (*Model, error) {
+	available, sized := readerSize(reader)
+	r := bufio.NewReader(reader)
+
+	magic := make([]byte, len(checkpointMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != checkpointMagic {
+		return nil, errors.New("not a physarum checkpoint")
+	}
+	version, err := readUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	if version != checkpointVersion {
+		return nil, fmt.Errorf("unsupported checkpoint version %d, expected %d", version, checkpointVersion)
+	}
+
+	size, err := readUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxCheckpointHeader {
+		return nil, fmt.Errorf("checkpoint header of %d bytes is too large", size)
+	}
+	headerBytes := make([]byte, size)
+	if _, err := io.ReadFull(r, headerBytes); err != nil {
+		return nil, err
+	}
+	var header checkpointHeader
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, err
+	}
+	if header.W < 1 || header.H < 1 || len(header.Configs) == 0 {
+		return nil, errors.New("invalid checkpoint header")
+	}
+	if err := header.check(); err != nil {
+		return nil, err
+	}
+	cells := int64(header.W) * int64(header.H)
+	if cells > maxCheckpointCells || cells*int64(len(header.Configs)) > maxCheckpointCells {
+		return nil, fmt.Errorf("checkpoint grids of %d x %d x %d are too large", header.W, header.H, len(header.Configs))
+	}
+	if header.NumParticles < 0 || header.NumParticles > maxCheckpointParticles {
+		return nil, fmt.Errorf("checkpoint has %d particles, at most %d are supported", header.NumParticles, maxCheckpointParticles)
+	}
+
+	// Everything that follows has a known size, except the food cells
+	payload := 16*int64(header.NumParticles) + 4*cells*int64(len(header.Configs)) + 4*int64(len(header.Food))
+	if header.Obstacles {
+		payload += (cells + 7) / 8
+	}
+	if sized && available < int64(len(checkpointMagic))+8+int64(size)+payload {
+		return nil, errors.New("checkpoint is truncated")
+	}
+
+	m := &Model{
+		W:               header.W,
+		H:               header.H,
+		BlurRadius:      header.BlurRadius,
+		BlurPasses:      header.BlurPasses,
+		ZoomFactor:      header.ZoomFactor,
+		Configs:         header.Configs,
+		AttractionTable: header.AttractionTable,
+		Iteration:       header.Iteration,
+		InitType:        header.InitType,
+		Boundary:        header.Boundary,
+		ObstacleMask:    header.ObstacleMask,
+		Food:            header.Food,
+		Deterministic:   header.Deterministic,
+		MaxParticles:    header.MaxParticles,
+		numParticles:    header.TotalParticles,
+		seed:            header.Seed,
+
+		BlurKernel:    header.BlurKernel,
+		BlurSigma:     header.BlurSigma,
+		DiffusionRate: header.DiffusionRate,
+		BlurRadiusX:   header.BlurRadiusX,
+		BlurRadiusY:   header.BlurRadiusY,
+
+		Interpolation: header.Interpolation,
+		Exclusion:     header.Exclusion,
+
+		GridPrecision: header.GridPrecision,
+		FusedSensing:  header.FusedSensing,
+	}
+
+	if header.Obstacles {
+		bits := make([]byte, (m.W*m.H+7)/8)
+		if _, err := io.ReadFull(r, bits); err != nil {
+			return nil, err
+		}
+		m.Obstacles = make([]bool, m.W*m.H)
+		for i := range m.Obstacles {
+			m.Obstacles[i] = bits[i/8]&(1<<(i%8)) != 0
+		}
+	}
+
+	if err := m.UpdateSteerings(); err != nil {
+		return nil, err
+	}
+	if err := m.SetConversion(header.ConversionTable, header.ConversionThreshold); err != nil {
+		return nil, err
+	}
+
+	// The animated parameters are saved at their current values, and will be
+	// set from the keyframes again on the next step
+	if err := m.SetTimeline(header.Keyframes); err != nil {
+		return nil, err
+	}
+
+	m.food = make([]*food, len(m.Food))
+	for i := range m.food {
+		n, err := readUint32(r)
+		if err != nil {
+			return nil, err
+		}
+		if int64(n) > cells {
+			return nil, fmt.Errorf("food source %d has %d cells, but the grid only has %d", i, n, cells)
+		}
+		f := &food{source: m.Food[i], cells: make([]int, n), weights: make([]float32, n)}
+		for k := range f.cells {
+			cell, err := readUint32(r)
+			if err != nil {
+				return nil, err
+			}
+			weight, err := readUint32(r)
+			if err != nil {
+				return nil, err
+			}
+			if int64(cell) >= cells {
+				return nil, fmt.Errorf("food source %d feeds cell %d, outside of the grid", i, cell)
+			}
+			f.cells[k] = int(cell)
+			f.weights[k] = math.Float32frombits(weight)
+		}
+		m.food[i] = f
+	}
+
+	// Without knowing how much data there is, let the particles grow as they
+	// are read instead of trusting the header with a big allocation
+	capacity := header.NumParticles
+	if !sized && capacity > 1<<20 {
+		capacity = 1 << 20
+	}
+	var buf [16]byte
+	m.Particles = newParticles(capacity, header.CompactAngles)
+	for i := 0; i < header.NumParticles; i++ {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return nil, err
+		}
+		p := Particle{
+			math.Float32frombits(binary.LittleEndian.Uint32(buf[0:])),
+			math.Float32frombits(binary.LittleEndian.Uint32(buf[4:])),
+			math.Float32frombits(binary.LittleEndian.Uint32(buf[8:])),
+			binary.LittleEndian.Uint32(buf[12:]),
+		}
+		if int(p.C) >= len(m.Configs) {
+			return nil, fmt.Errorf("particle %d has species %d, but there are only %d", i, p.C, len(m.Configs))
+		}
+		m.Particles.Append(p)
+	}
+	m.Particles.Group(len(m.Configs))
+
+	m.Grids = make([]*Grid, len(m.Configs))
+	for c := range m.Grids {
+		grid := newGrid(m.W, m.H, m.Boundary, m.Obstacles, m.GridPrecision)
+		for i := 0; i < m.W*m.H; i++ {
+			value, err := readUint32(r)
+			if err != nil {
+				return nil, err
+			}
+			grid.setData(i, math.Float32frombits(value))
+		}
+		m.Grids[c] = grid
+	}
+
+	// The images of the parameter maps and flow are not saved, just where to find them
+	if err := m.LoadParameterMaps(); err != nil {
+		return nil, err
+	}
+	if err := m.SetFlow(header.Flow); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Check the options and tables of a header that the model would otherwise
+// only trip over while it runs
+func (h *checkpointHeader) check() error {
+	for _, option := range []struct {
+		name    string
+		value   string
+		options []string
+	}{
+		{"boundary", h.Boundary, AllBoundaries[:]},
+		{"grid precision", h.GridPrecision, AllGridPrecisions[:]},
+		{"interpolation", h.Interpolation, AllInterpolations[:]},
+		{"blur kernel", h.BlurKernel, AllKernels[:]},
+	} {
+		if !knownOption(option.value, option.options) {
+			return fmt.Errorf("checkpoint has unknown %s %q", option.name, option.value)
+		}
+	}
+	for c, config := range h.Configs {
+		if !knownOption(config.BlurKernel, AllKernels[:]) {
+			return fmt.Errorf("checkpoint species %d has unknown blur kernel %q", c, config.BlurKernel)
+		}
+	}
+
+	if len(h.AttractionTable) != len(h.Configs) {
+		return fmt.Errorf("checkpoint attraction table has %d rows, want %d", len(h.AttractionTable), len(h.Configs))
+	}
+	for c, row := range h.AttractionTable {
+		if len(row) != len(h.Configs) {
+			return fmt.Errorf("checkpoint attraction table row %d has %d entries, want %d", c, len(row), len(h.Configs))
+		}
+	}
+	return nil
+}
+
+// Is the value one of the options, or empty for the default one
+func knownOption(value string, options []string) bool {
+	if value == "" {
+		return true
+	}
+	for _, option := range options {
+		if value == option {
+			return true
+		}
+	}
+	return false
+}
+
+// Number of bytes left in the reader, if it can tell
+func readerSize(reader io.Reader) (int64, bool) {
+	switch r := reader.(type) {
+	case interface{ Len() int }:
+		return int64(r.Len()), true
+	case *os.File:
+		info, err := r.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0, false
+		}
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		return info.Size() - offset, true
+	}
+	return 0, false
+}
+
+func writeUint32(w *bufio.Writer, value uint32) {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], value)
+	w.Write(buf[:])
+}
+
+func readUint32(r *bufio.Reader) (uint32, error) {
+	var buf [4]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(buf[:]), nil
+}
+
+// Write a checkpoint to a file, creating its directory if needed
+func (m *Model) SaveCheckpointFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := m.SaveCheckpoint(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Read a checkpoint written by SaveCheckpointFile
+func LoadCheckpointFile(path string) (*Model, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return LoadCheckpoint(file)
+}
@@ -0,0 +1,157 @@
+package physarum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	obstacles := make([]bool, 96*64)
+	for i := 0; i < 64; i++ {
+		obstacles[i*96+40] = true
+	}
+	m := NewModel(96, 64, 3000, 1, 2, 1, RandomConfigs(rnd, 3), RandomAttractionTable(rnd, 3), Random, Reflective, obstacles, 7)
+	m.ObstacleMask = "walls.png"
+	if err := m.SetFood([]FoodSource{{X: 10, Y: 20, Radius: 4, Strength: 2, Period: 16}}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		m.Step()
+	}
+
+	var buf bytes.Buffer
+	if err := m.SaveCheckpoint(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCheckpoint(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Seed() != m.Seed() || loaded.ObstacleMask != m.ObstacleMask {
+		t.Fatalf("got seed %d and mask %q, want %d and %q", loaded.Seed(), loaded.ObstacleMask, m.Seed(), m.ObstacleMask)
+	}
+
+	// Both copies should carry on identically
+	for i := 0; i < 10; i++ {
+		m.Step()
+		loaded.Step()
+	}
+	if loaded.Iteration != m.Iteration {
+		t.Fatalf("got iteration %v, want %v", loaded.Iteration, m.Iteration)
+	}
+	for i, p := range allParticles(m) {
+		if loaded.Particles.At(i) != p {
+			t.Fatalf("particle %d: got %v, want %v", i, loaded.Particles.At(i), p)
+		}
+	}
+	for c, grid := range m.Grids {
+		for i, value := range grid.Data {
+			if loaded.Grids[c].Data[i] != value {
+				t.Fatalf("grid %d cell %d: got %v, want %v", c, i, loaded.Grids[c].Data[i], value)
+			}
+		}
+	}
+}
+
+func TestCheckpointBadMagic(t *testing.T) {
+	if _, err := LoadCheckpoint(bytes.NewReader([]byte("nope, not a checkpoint"))); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+// A checkpoint with just a header, and none of the data it promises
+func headerOnlyCheckpoint(t *testing.T, header checkpointHeader) []byte {
+	data, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(checkpointMagic)
+	binary.Write(&buf, binary.LittleEndian, uint32(checkpointVersion))
+	binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func TestCheckpointLimits(t *testing.T) {
+	configs := []Config{{}}
+	table := [][]float32{{1}}
+	table5 := make([][]float32, 5)
+	for c := range table5 {
+		table5[c] = make([]float32, 5)
+	}
+	for _, header := range []checkpointHeader{
+		{W: 16, H: 16, Configs: configs, AttractionTable: table, NumParticles: maxCheckpointParticles + 1},
+		{W: 16, H: 16, Configs: configs, AttractionTable: table, NumParticles: -1},
+		{W: 1 << 15, H: 1 << 15, Configs: configs, AttractionTable: table},
+		{W: 1 << 14, H: 1 << 13, Configs: make([]Config, 5), AttractionTable: table5},
+		{W: 16, H: 16, Configs: configs, AttractionTable: table, NumParticles: 1000}, // Truncated
+	} {
+		data := headerOnlyCheckpoint(t, header)
+		if _, err := LoadCheckpoint(bytes.NewReader(data)); err == nil {
+			t.Errorf("%d x %d, %d particles: expected an error", header.W, header.H, header.NumParticles)
+		}
+		// Without a known size the data runs out instead
+		if _, err := LoadCheckpoint(io.MultiReader(bytes.NewReader(data))); err == nil {
+			t.Errorf("%d x %d, %d particles, unsized: expected an error", header.W, header.H, header.NumParticles)
+		}
+	}
+}
+
+func TestCheckpointInvalid(t *testing.T) {
+	for name, change := range map[string]func(m *Model){
+		"boundary":          func(m *Model) { m.Boundary = "sticky" },
+		"grid precision":    func(m *Model) { m.GridPrecision = "float8" },
+		"interpolation":     func(m *Model) { m.Interpolation = "cubic" },
+		"blur kernel":       func(m *Model) { m.BlurKernel = "median" },
+		"species kernel":    func(m *Model) { m.Configs[1].BlurKernel = "median" },
+		"attraction rows":   func(m *Model) { m.AttractionTable = m.AttractionTable[:1] },
+		"attraction row":    func(m *Model) { m.AttractionTable[1] = m.AttractionTable[1][:1] },
+		"conversion rows":   func(m *Model) { m.ConversionTable = [][]float32{{0, 1}} },
+		"conversion column": func(m *Model) { m.ConversionTable = [][]float32{{0, 1}, {1}} },
+	} {
+		rnd := rand.New(rand.NewSource(1))
+		m := NewModel(16, 16, 100, 1, 2, 1, RandomConfigs(rnd, 2), RandomAttractionTable(rnd, 2), Random, Toroidal, nil, 7)
+		change(m)
+		var buf bytes.Buffer
+		if err := m.SaveCheckpoint(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadCheckpoint(&buf); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCheckpointVersion(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	m := NewModel(16, 16, 100, 1, 2, 1, RandomConfigs(rnd, 2), RandomAttractionTable(rnd, 2), Random, Toroidal, nil, 7)
+	m.Configs[0].BlurRadius = Int(0)
+	var buf bytes.Buffer
+	if err := m.SaveCheckpoint(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if _, err := LoadCheckpoint(bytes.NewReader(data[:len(data)-1])); err == nil {
+		t.Fatal("expected an error for a byte short")
+	}
+
+	loaded, err := LoadCheckpoint(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := loaded.Configs[0].BlurRadius; r == nil || *r != 0 {
+		t.Fatalf("got blur radius %v, want 0", r)
+	}
+
+	binary.LittleEndian.PutUint32(data[len(checkpointMagic):], checkpointVersion+1)
+	if _, err := LoadCheckpoint(bytes.NewReader(data)); err == nil {
+		t.Fatal("expected an error for a newer version")
+	}
+}
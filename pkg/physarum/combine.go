@@ -0,0 +1,121 @@
+package physarum
+
+import "math"
+
+// Attraction factors smaller than this are left out of the combined fields
+const minAttraction = 1e-4
+
+// A grid and how much it attracts a species
+type attractionTerm struct {
+	grid   *Grid
+	factor float32
+}
+
+// The factors of the attraction table that matter, per species
+func (m *Model) attractionTerms() [][]attractionTerm {
+	if len(m.attraction) != len(m.Configs) {
+		m.attraction = make([][]attractionTerm, len(m.Configs))
+	}
+	for c := range m.Configs {
+		terms := m.attraction[c][:0]
+		for i, factor := range m.AttractionTable[c] {
+			if math.Abs(float64(factor)) >= minAttraction {
+				terms = append(terms, attractionTerm{m.Grids[i], factor})
+			}
+		}
+		m.attraction[c] = terms
+	}
+	return m.attraction
+}
+
+// Sum the grids into the combined field of every species, in Temp
+func (m *Model) combineGrids() {
+	if isHalf(m.GridPrecision) {
+		m.combineHalfGrids()
+		return
+	}
+
+	for c, grid := range m.Grids {
+		terms := m.attraction[c]
+		parallelRows(m.H, func(y0, y1 int) {
+			temp := grid.Temp[y0*m.W : y1*m.W]
+			if len(terms) == 0 {
+				for j := range temp {
+					temp[j] = 0
+				}
+				return
+			}
+			// The first term sets the field, instead of clearing it first
+			factor := terms[0].factor
+			for j, value := range terms[0].grid.Data[y0*m.W : y1*m.W] {
+				temp[j] = value * factor
+			}
+			for _, term := range terms[1:] {
+				factor := term.factor
+				for j, value := range term.grid.Data[y0*m.W : y1*m.W] {
+					temp[j] += value * factor
+				}
+			}
+		})
+	}
+}
+
+// Like combineGrids, but a cell at a time over all the grids, so the sums
+// never need a full float32 grid
+func (m *Model) combineHalfGrids() {
+	for c, grid := range m.Grids {
+		terms := m.attraction[c]
+		parallelRows(m.H, func(y0, y1 int) {
+			for j := y0 * m.W; j < y1*m.W; j++ {
+				var sum float32
+				for _, term := range terms {
+					sum += halfTable[term.grid.data16[j]] * term.factor
+				}
+				grid.temp16[j] = toHalf(sum)
+			}
+		})
+	}
+}
+
+// Combined field of species c at x, y. With FusedSensing it is summed from
+// the grids right here, otherwise read from the field combineGrids built.
+// Both give the same readings, bilinear ones too, as the fused sums are
+// interpolated between cells and rounded just like the combined fields.
+func (m *Model) sense(c int, x, y float32, bilinear bool) float32 {
+	grid := m.Grids[c]
+	if !m.FusedSensing {
+		if bilinear {
+			return grid.GetTempBilinear(x, y)
+		}
+		return grid.GetTemp(x, y)
+	}
+	if bilinear {
+		i00, i10, i01, i11, w00, w10, w01, w11 := grid.bilinear(x, y)
+		return m.fusedAt(c, i00)*w00 + m.fusedAt(c, i10)*w10 + m.fusedAt(c, i01)*w01 + m.fusedAt(c, i11)*w11
+	}
+	if grid.outside(x, y) {
+		return 0
+	}
+	return m.fusedAt(c, grid.Index(x, y))
+}
+
+// Combined field of species c in cell i, like sense
+func (m *Model) combinedAt(c, i int) float32 {
+	if !m.FusedSensing {
+		return m.Grids[c].tempAt(i)
+	}
+	return m.fusedAt(c, i)
+}
+
+// Sum of the grids attracting species c in cell i, in the order combineGrids
+// adds them up, rounded to a half float with Float16Grids like combineHalfGrids
+func (m *Model) fusedAt(c, i int) float32 {
+	var sum float32
+	for _, term := range m.attraction[c] {
+		sum += term.grid.dataAt(i) * term.factor
+	}
+	if m.Grids[c].temp16 != nil {
+		return halfTable[toHalf(sum)]
+	}
+	return sum
+}
@@ -0,0 +1,41 @@
+package physarum
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestFusedSensing(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	configs := RandomConfigs(rnd, 3)
+	table := RandomAttractionTable(rnd, 3)
+	table[0][2] = 0
+	table[1][0] = minAttraction / 2
+	run := func(fused bool, interpolation, precision string) *Model {
+		m := newModel(64, 64, 2000, 1, 2, 1, configs, table, Random, Toroidal, nil, 9)
+		m.Deterministic = true
+		m.FusedSensing = fused
+		m.Interpolation = interpolation
+		m.GridPrecision = precision
+		m.StartOver()
+		for i := 0; i < 10; i++ {
+			m.Step()
+		}
+		return m
+	}
+
+	for _, interpolation := range AllInterpolations {
+		for _, precision := range AllGridPrecisions {
+			a := run(false, interpolation, precision)
+			b := run(true, interpolation, precision)
+			if len(a.attraction[0]) != 2 || len(a.attraction[1]) != 2 || len(a.attraction[2]) != 3 {
+				t.Fatalf("got %d, %d and %d terms, want 2, 2 and 3", len(a.attraction[0]), len(a.attraction[1]), len(a.attraction[2]))
+			}
+			for i, p := range allParticles(a) {
+				if b.Particles.At(i) != p {
+					t.Fatalf("%s %s particle %d: got %v, want %v", interpolation, precision, i, b.Particles.At(i), p)
+				}
+			}
+		}
+	}
+}
@@ -2,6 +2,7 @@ package physarum
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 )
 
@@ -32,11 +33,45 @@ type Config struct {
 	StepDistance     float32
 	DepositionAmount float32
 	DecayFactor      float32
+
+	// Optional size of this species, either a number of particles or a share
+	// of the total, species with neither split whatever is left evenly
+	Particles        int
+	ParticleFraction float32
+
+	Sensors             []Sensor // Optional layout of the sensors, see SensorLayout
+	Steering            string   // Name of the steering policy, "classic" if empty
+	SteeringTemperature float32  // Temperature of the "softmax" steering policy, 1 if zero
+
+	// Optional population dynamics, judged on the species' own trail where a
+	// particle is after it moves, each rule is disabled while its threshold is zero
+	DeathBelow   float32 // Die if the trail is lower than this
+	DeathAbove   float32 // Die if the trail is higher than this, too crowded
+	DivideAbove  float32 // Divide in two if the trail is higher than this
+	DeathChance  float32 // Chance of dying each step a death rule applies, 1 if zero
+	DivideChance float32 // Chance of dividing each step the divide rule applies, 1 if zero
+	MaxParticles int     // Cap on the number of particles of this species, no cap if zero
+
+	ParameterMaps []ParameterMap // Optional images that scale parameters across the grid
+
+	// Optional diffusion of this species' trail, each one left out uses the
+	// model's value, so a species can still ask for a radius or passes of zero
+	BlurKernel    string
+	BlurRadius    *int
+	BlurPasses    *int
+	BlurSigma     *float32
+	DiffusionRate *float32
+	BlurRadiusX   *int
+	BlurRadiusY   *int
 }
 
-func RandomConfig() Config {
+// Pointers to values, to write the optional overrides of a Config in a literal
+func Int(v int) *int             { return &v }
+func Float32(v float32) *float32 { return &v }
+
+func RandomConfig(rnd *rand.Rand) Config {
 	uniform := func(min, max float32) float32 {
-		return min + rand.Float32()*(max-min)
+		return min + rnd.Float32()*(max-min)
 	}
 
 	sensorAngle := Radians(uniform(sensorAngleMin, sensorAngleMax))
@@ -56,17 +91,17 @@ func RandomConfig() Config {
 	}
 }
 
-func RandomConfigs(n int) []Config {
+func RandomConfigs(rnd *rand.Rand, n int) []Config {
 	configs := make([]Config, n)
 	for i := range configs {
-		configs[i] = RandomConfig()
+		configs[i] = RandomConfig(rnd)
 	}
 	return configs
 }
 
-func RandomAttractionTable(n int) [][]float32 {
+func RandomAttractionTable(rnd *rand.Rand, n int) [][]float32 {
 	normal := func(mean, std float32) float32 {
-		return mean + float32(rand.NormFloat64())*std
+		return mean + float32(rnd.NormFloat64())*std
 	}
 
 	result := make([][]float32, n)
@@ -86,13 +121,42 @@ func RandomAttractionTable(n int) [][]float32 {
 func PrintConfigs(configs []Config, table [][]float32) {
 	fmt.Println("configs = []Config{")
 	for _, c := range configs {
-		fmt.Printf("\tConfig{%v, %v, %v, %v, %v, %v},\n",
+		fmt.Printf("\tConfig{SensorAngle: %v, SensorDistance: %v, RotationAngle: %v, StepDistance: %v, DepositionAmount: %v, DecayFactor: %v",
 			c.SensorAngle,
 			c.SensorDistance,
 			c.RotationAngle,
 			c.StepDistance,
 			c.DepositionAmount,
 			c.DecayFactor)
+		if c.Steering != "" {
+			fmt.Printf(", Steering: %q", c.Steering)
+		}
+		if c.SteeringTemperature != 0 {
+			fmt.Printf(", SteeringTemperature: %v", c.SteeringTemperature)
+		}
+		if c.BlurKernel != "" {
+			fmt.Printf(", BlurKernel: %q", c.BlurKernel)
+		}
+		for _, override := range []struct {
+			name  string
+			value *int
+		}{
+			{"BlurRadius", c.BlurRadius},
+			{"BlurPasses", c.BlurPasses},
+			{"BlurRadiusX", c.BlurRadiusX},
+			{"BlurRadiusY", c.BlurRadiusY},
+		} {
+			if override.value != nil {
+				fmt.Printf(", %s: Int(%v)", override.name, *override.value)
+			}
+		}
+		if c.BlurSigma != nil {
+			fmt.Printf(", BlurSigma: Float32(%v)", *c.BlurSigma)
+		}
+		if c.DiffusionRate != nil {
+			fmt.Printf(", DiffusionRate: Float32(%v)", *c.DiffusionRate)
+		}
+		fmt.Println("},")
 	}
 	fmt.Println("}")
 	fmt.Println("table = [][]float32{")
@@ -109,6 +173,44 @@ func PrintConfigs(configs []Config, table [][]float32) {
 	fmt.Println("}")
 }
 
+// Number of particles of each species out of a total of numParticles. The
+// species without a count of their own split what the others leave exactly,
+// and it is an error if that leaves some of them without any particles.
+func ParticleCounts(numParticles int, configs []Config) ([]int, error) {
+	counts := make([]int, len(configs))
+	remaining := numParticles
+	var unspecified []int
+	for i, c := range configs {
+		switch {
+		case c.Particles > 0:
+			counts[i] = c.Particles
+		case c.ParticleFraction > 0:
+			counts[i] = int(math.Round(float64(c.ParticleFraction) * float64(numParticles)))
+		default:
+			unspecified = append(unspecified, i)
+			continue
+		}
+		remaining -= counts[i]
+	}
+	if len(unspecified) == 0 || remaining <= 0 && numParticles == 0 {
+		return counts, nil
+	}
+	if remaining < len(unspecified) {
+		if remaining < 0 {
+			remaining = 0
+		}
+		return nil, fmt.Errorf("the species with a count take all but %d of %d particles, leaving too few for the other %d species",
+			remaining, numParticles, len(unspecified))
+	}
+	for k, i := range unspecified {
+		counts[i] = remaining / len(unspecified)
+		if k < remaining%len(unspecified) {
+			counts[i]++
+		}
+	}
+	return counts, nil
+}
+
 func SummarizeConfigs(configs []Config) {
 	summarize := func(name string, getter func(i int) float32) {
 		fmt.Printf("%s ", name)
@@ -0,0 +1,45 @@
+package physarum
+
+import (
+	"testing"
+)
+
+func TestParticleCounts(t *testing.T) {
+	cases := []struct {
+		total   int
+		configs []Config
+		want    []int
+	}{
+		{10, []Config{{}, {}, {}}, []int{4, 3, 3}},
+		{1000, []Config{{Particles: 10}, {}}, []int{10, 990}},
+		{1000, []Config{{ParticleFraction: 0.05}, {}, {}}, []int{50, 475, 475}},
+		{1000, []Config{{ParticleFraction: 0.25}, {Particles: 100}}, []int{250, 100}},
+		{100, []Config{{Particles: 200}}, []int{200}},
+		{0, []Config{{}, {}}, []int{0, 0}},
+	}
+	for _, c := range cases {
+		got, err := ParticleCounts(c.total, c.configs)
+		if err != nil {
+			t.Fatalf("ParticleCounts(%v, %v): %v", c.total, c.configs, err)
+		}
+		for i := range c.want {
+			if got[i] != c.want[i] {
+				t.Fatalf("ParticleCounts(%v, %v) = %v, want %v", c.total, c.configs, got, c.want)
+			}
+		}
+	}
+
+	// Species left without particles
+	for _, c := range []struct {
+		total   int
+		configs []Config
+	}{
+		{100, []Config{{Particles: 200}, {}}},
+		{100, []Config{{Particles: 100}, {}}},
+		{100, []Config{{ParticleFraction: 0.99}, {}, {}}},
+	} {
+		if counts, err := ParticleCounts(c.total, c.configs); err == nil {
+			t.Errorf("ParticleCounts(%v, %v) = %v, expected an error", c.total, c.configs, counts)
+		}
+	}
+}
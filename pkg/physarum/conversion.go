@@ -0,0 +1,46 @@
+package physarum
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Set how particles switch species. table[c][d] is the chance each step that a
+// particle of species c becomes species d, when the combined field of d where
+// the particle is exceeds threshold times the combined field of c. The
+// threshold is 1 if zero, and a nil table turns conversion off.
+func (m *Model) SetConversion(table [][]float32, threshold float32) error {
+	if table != nil {
+		if len(table) != len(m.Configs) {
+			return fmt.Errorf("conversion table has %d rows, want %d", len(table), len(m.Configs))
+		}
+		for c, row := range table {
+			if len(row) != len(m.Configs) {
+				return fmt.Errorf("conversion table row %d has %d entries, want %d", c, len(row), len(m.Configs))
+			}
+		}
+	}
+	m.ConversionTable = table
+	m.ConversionThreshold = threshold
+	return nil
+}
+
+// Maybe switch a particle to a species whose combined field dominates where it is
+func (m *Model) convertParticle(rnd *rand.Rand, p *Particle) {
+	threshold := m.ConversionThreshold
+	if threshold == 0 {
+		threshold = 1
+	}
+	i := m.Grids[p.C].Index(p.X, p.Y)
+	own := m.combinedAt(int(p.C), i)
+	for d, probability := range m.ConversionTable[p.C] {
+		if probability <= 0 || d == int(p.C) {
+			continue
+		}
+		other := m.combinedAt(d, i)
+		if other > 0 && other > threshold*own && rnd.Float32() < probability {
+			p.C = uint32(d)
+			return
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package physarum
+
+// Particles sorted by species and by the band of rows they deposit into, so
+// every species and band can deposit in parallel without locks
+type depositBuffers struct {
+	keys   []int32 // Species and band of each particle
+	counts []int   // Number of particles of each key in the chunk of each worker, then where they go in order
+	starts []int   // Where the particles of each key start in order
+	order  []int32 // Indices of the particles, by key and then by index
+}
+
+const (
+	depositBandRows = 16 // Fewest rows in a band
+	maxDepositBands = 64
+)
+
+// Number of row bands the deposits are split into. It is even, so that the
+// bilinear splats of every other band, which reach one row into the next
+// band, never touch the same rows. It only depends on the height, so the
+// order of the deposits into each cell does not depend on the number of workers.
+func depositBands(h int) int {
+	bands := h / depositBandRows
+	if bands > maxDepositBands {
+		bands = maxDepositBands
+	}
+	bands &^= 1
+	if bands < 2 {
+		return 1
+	}
+	return bands
+}
+
+// Add the deposits of all particles to the grids of their species
+func (m *Model) deposit(workers int, bilinear bool) {
+	m.sortDeposits(workers, bilinear)
+	m.depositSpecies(workers, bilinear, 0, len(m.Configs))
+}
+
+// Sort the particles by the species and band they deposit into
+func (m *Model) sortDeposits(workers int, bilinear bool) {
+	bands := depositBands(m.H)
+	numKeys := len(m.Configs) * bands
+	ps := &m.Particles
+	n := ps.Len()
+	d := &m.deposits
+	if cap(d.keys) < n {
+		d.keys = make([]int32, n)
+		d.order = make([]int32, n)
+	}
+	d.keys = d.keys[:n]
+	d.order = d.order[:n]
+	if len(d.counts) != workers*numKeys {
+		d.counts = make([]int, workers*numKeys)
+		d.starts = make([]int, numKeys+1)
+	}
+	for i := range d.counts {
+		d.counts[i] = 0
+	}
+
+	// Counting sort of the particles by key, each worker takes a chunk of them
+	// and goes through the part of it in each species' range
+	chunk := (n + workers - 1) / workers
+	parallelFor(workers, workers, func(w int) {
+		counts := d.counts[w*numKeys : (w+1)*numKeys]
+		for c, grid := range m.Grids {
+			i0, i1 := ps.Species(c)
+			if i0 < w*chunk {
+				i0 = w * chunk
+			}
+			if i1 > (w+1)*chunk {
+				i1 = (w + 1) * chunk
+			}
+			for i := i0; i < i1; i++ {
+				// Top left cell the particle deposits into
+				var cell int
+				if bilinear {
+					cell, _, _, _, _, _, _, _ = grid.bilinear(ps.X[i], ps.Y[i])
+				} else {
+					cell = grid.Index(ps.X[i], ps.Y[i])
+				}
+				key := c*bands + cell/m.W*bands/m.H
+				d.keys[i] = int32(key)
+				counts[key]++
+			}
+		}
+	})
+	offset := 0
+	for key := 0; key < numKeys; key++ {
+		d.starts[key] = offset
+		for w := 0; w < workers; w++ {
+			count := d.counts[w*numKeys+key]
+			d.counts[w*numKeys+key] = offset
+			offset += count
+		}
+	}
+	d.starts[numKeys] = offset
+	parallelFor(workers, workers, func(w int) {
+		offsets := d.counts[w*numKeys : (w+1)*numKeys]
+		for i := w * chunk; i < n && i < (w+1)*chunk; i++ {
+			key := d.keys[i]
+			d.order[offsets[key]] = int32(i)
+			offsets[key]++
+		}
+	})
+}
+
+// Add the deposits of the particles of species c0 to c1-1, after sortDeposits
+func (m *Model) depositSpecies(workers int, bilinear bool, c0, c1 int) {
+	bands := depositBands(m.H)
+	ps := &m.Particles
+	d := &m.deposits
+
+	depositKey := func(key int) {
+		c := key / bands
+		grid := m.Grids[c]
+		amount := m.Configs[c].DepositionAmount
+		var depositionScale []float32
+		if c < len(m.parameterScales) && m.parameterScales[c] != nil {
+			depositionScale = m.parameterScales[c][depositionAmountMap]
+		}
+		for _, i := range d.order[d.starts[key]:d.starts[key+1]] {
+			x, y := ps.X[i], ps.Y[i]
+			a := amount
+			if depositionScale != nil {
+				a *= depositionScale[grid.Index(x, y)]
+			}
+			if bilinear {
+				grid.AddBilinear(x, y, a)
+			} else {
+				grid.Add(x, y, a)
+			}
+		}
+	}
+
+	// Even bands first and then odd ones, bilinear splats reach into the next band
+	phases := 1
+	if bilinear && bands > 1 {
+		phases = 2
+	}
+	for phase := 0; phase < phases; phase++ {
+		tasks := (c1 - c0) * bands / phases
+		parallelFor(tasks, workers, func(t int) {
+			key := c0*bands + t
+			if phases == 2 {
+				key = c0*bands + 2*t + phase
+			}
+			depositKey(key)
+		})
+	}
+}
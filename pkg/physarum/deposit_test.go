@@ -0,0 +1,62 @@
+package physarum
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func depositModel(species, particles int) *Model {
+	rnd := rand.New(rand.NewSource(1))
+	m := NewModel(480, 270, particles, 1, 2, 1, RandomConfigs(rnd, species), RandomAttractionTable(rnd, species), Random, Toroidal, nil, 1)
+	for c := range m.Configs {
+		m.Configs[c].DepositionAmount = float32(c + 1)
+	}
+	return m
+}
+
+func TestDeposit(t *testing.T) {
+	m := depositModel(3, 20000)
+	want := make([][]float32, len(m.Grids))
+	for c := range want {
+		want[c] = make([]float32, m.W*m.H)
+	}
+	for _, p := range allParticles(m) {
+		want[p.C][m.Grids[p.C].Index(p.X, p.Y)] += m.Configs[p.C].DepositionAmount
+	}
+	m.deposit(5, false)
+	for c, grid := range m.Grids {
+		for i, value := range grid.Data {
+			if value != want[c][i] {
+				t.Fatalf("species %d cell %d: got %v, want %v", c, i, value, want[c][i])
+			}
+		}
+	}
+
+	// Bilinear splats cross the bands, but still end up the same for any number of workers
+	run := func(workers int) [][]float32 {
+		m := depositModel(3, 20000)
+		m.deposit(workers, true)
+		return m.Data()
+	}
+	a, b := run(1), run(7)
+	for c := range a {
+		for i := range a[c] {
+			if a[c][i] != b[c][i] {
+				t.Fatalf("bilinear species %d cell %d: got %v, want %v", c, i, b[c][i], a[c][i])
+			}
+		}
+	}
+}
+
+func BenchmarkDeposit(b *testing.B) {
+	for _, species := range []int{1, 5} {
+		b.Run(fmt.Sprintf("%d species", species), func(b *testing.B) {
+			m := depositModel(species, 1<<20)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m.deposit(8, false)
+			}
+		})
+	}
+}
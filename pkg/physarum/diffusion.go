@@ -0,0 +1,238 @@
+package physarum
+
+import (
+	"log"
+	"math"
+)
+
+// All the supported diffusion kernels
+const (
+	BoxKernel         = "box"         // Running sum box blur, repeated BlurPasses times
+	GaussianKernel    = "gaussian"    // True gaussian blur by sigma, in a single pass
+	LaplacianKernel   = "laplacian"   // Explicit steps of the heat equation, repeated BlurPasses times
+	AnisotropicKernel = "anisotropic" // Box blur with separate horizontal and vertical radii
+)
+
+// All of the supported diffusion kernels in a slice
+var AllKernels = [...]string{
+	BoxKernel,
+	GaussianKernel,
+	LaplacianKernel,
+	AnisotropicKernel,
+}
+
+const (
+	defaultDiffusionRate = 0.2
+	maxDiffusionRate     = 0.25 // The explicit laplacian step is unstable beyond this
+)
+
+// How trail spreads out over a grid every step
+type Diffusion struct {
+	Kernel  string  // One of AllKernels, box if empty
+	Radius  int     // Radius of the box kernel
+	Passes  int     // Number of passes of the box, laplacian and anisotropic kernels
+	RadiusX int     // Horizontal radius of the anisotropic kernel, Radius if zero
+	RadiusY int     // Vertical radius of the anisotropic kernel, Radius if zero
+	Sigma   float32 // Standard deviation of the gaussian kernel in cells, Radius if zero
+	Rate    float32 // Diffusion coefficient of the laplacian kernel, 0.2 if zero, at most 0.25
+}
+
+// The diffusion of species c, its config's values where set and the model's otherwise
+func (m *Model) diffusion(c int) Diffusion {
+	d := Diffusion{
+		Kernel:  m.BlurKernel,
+		Radius:  m.BlurRadius,
+		Passes:  m.BlurPasses,
+		RadiusX: m.BlurRadiusX,
+		RadiusY: m.BlurRadiusY,
+		Sigma:   m.BlurSigma,
+		Rate:    m.DiffusionRate,
+	}
+	config := m.Configs[c]
+	if config.BlurKernel != "" {
+		d.Kernel = config.BlurKernel
+	}
+	if config.BlurRadius != nil {
+		d.Radius = *config.BlurRadius
+	}
+	if config.BlurPasses != nil {
+		d.Passes = *config.BlurPasses
+	}
+	if config.BlurRadiusX != nil {
+		d.RadiusX = *config.BlurRadiusX
+	}
+	if config.BlurRadiusY != nil {
+		d.RadiusY = *config.BlurRadiusY
+	}
+	if config.BlurSigma != nil {
+		d.Sigma = *config.BlurSigma
+	}
+	if config.DiffusionRate != nil {
+		d.Rate = *config.DiffusionRate
+	}
+	return d
+}
+
+// Spread the trail out with the kernel of d, and decay it by decayFactor
+func (g *Grid) Diffuse(d Diffusion, decayFactor float32) {
+	switch d.Kernel {
+	case BoxKernel, "":
+		g.BoxBlur(d.Radius, d.Passes, decayFactor)
+	case AnisotropicKernel:
+		rx, ry := d.RadiusX, d.RadiusY
+		if rx == 0 {
+			rx = d.Radius
+		}
+		if ry == 0 {
+			ry = d.Radius
+		}
+		g.AnisotropicBlur(rx, ry, d.Passes, decayFactor)
+	case GaussianKernel:
+		sigma := d.Sigma
+		if sigma == 0 {
+			sigma = float32(d.Radius)
+		}
+		g.GaussianBlur(sigma, decayFactor)
+	case LaplacianKernel:
+		rate := d.Rate
+		if rate == 0 {
+			rate = defaultDiffusionRate
+		}
+		g.LaplacianDiffuse(rate, d.Passes, decayFactor)
+	default:
+		log.Fatalf("unknown blur kernel %q", d.Kernel)
+	}
+}
+
+// Blur the grid once with a gaussian of standard deviation sigma
+func (g *Grid) GaussianBlur(sigma, decayFactor float32) {
+	if sigma <= 0 {
+		g.BoxBlur(0, 0, decayFactor)
+		return
+	}
+	weights := gaussianWeights(sigma)
+	if g.Obstacles != nil {
+		wallBlur(g.Data, g.Temp, g.W, g.H, g.Obstacles, g.edge, convolveStretch(weights, 1), convolveStretch(weights, decayFactor))
+		g.decayMap()
+		return
+	}
+	pooledConvolveH(g.Data, g.Temp, g.W, g.H, weights, 1, g.edge)
+	transpose(g.Temp, g.Data, g.W, g.H)
+	pooledConvolveH(g.Data, g.Temp, g.H, g.W, weights, decayFactor, g.edge)
+	transpose(g.Temp, g.Data, g.H, g.W)
+	g.decayMap()
+}
+
+// Normalized weights of a gaussian kernel, from -r to r with r = ceil(3 sigma)
+func gaussianWeights(sigma float32) []float32 {
+	r := int(math.Ceil(3 * float64(sigma)))
+	weights := make([]float32, r+r+1)
+	var sum float64
+	for k := -r; k <= r; k++ {
+		w := math.Exp(-float64(k*k) / (2 * float64(sigma) * float64(sigma)))
+		weights[k+r] = float32(w)
+		sum += w
+	}
+	for i := range weights {
+		weights[i] /= float32(sum)
+	}
+	return weights
+}
+
+// Convolve a single line of n cells starting at off, spaced stride apart
+func convolveLine(src, dst []float32, off, stride, n int, weights []float32, scale float32, edge edgeMode) {
+	r := len(weights) / 2
+	for k := 0; k < n; k++ {
+		var val float32
+		if k >= r && k+r < n {
+			i := off + (k-r)*stride
+			for _, weight := range weights {
+				val += src[i] * weight
+				i += stride
+			}
+		} else {
+			for j, weight := range weights {
+				val += edgeAt(src, off, stride, n, k+j-r, edge) * weight
+			}
+		}
+		dst[off+k*stride] = val * scale
+	}
+}
+
+// Convolution of a stretch of open cells with the weights, times scale
+func convolveStretch(weights []float32, scale float32) stretchBlur {
+	r := len(weights) / 2
+	return func(in, out []float32, lo, hi edgeMode) {
+		for k := range in {
+			var val float32
+			for j, weight := range weights {
+				val += stretchAt(in, k+j-r, lo, hi) * weight
+			}
+			out[k] = val * scale
+		}
+	}
+}
+
+// Convolution of every row on tiles of rows run by the shared worker pool
+func pooledConvolveH(src, dst []float32, w, h int, weights []float32, scale float32, edge edgeMode) {
+	parallelRows(h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			convolveLine(src, dst, y*w, 1, w, weights, scale, edge)
+		}
+	})
+}
+
+// Take iterations explicit steps of the heat equation with diffusion
+// coefficient rate. No trail flows into or out of the walls, and absorbing
+// edges drain it.
+func (g *Grid) LaplacianDiffuse(rate float32, iterations int, decayFactor float32) {
+	if rate > maxDiffusionRate {
+		rate = maxDiffusionRate
+	}
+	if iterations < 1 {
+		g.BoxBlur(0, 0, decayFactor)
+		return
+	}
+	for i := 0; i < iterations; i++ {
+		scale := float32(1)
+		if i == iterations-1 {
+			scale = decayFactor
+		}
+		g.laplacianStep(rate, scale)
+		g.clearObstacles()
+	}
+	g.decayMap()
+}
+
+func (g *Grid) laplacianStep(rate, scale float32) {
+	w, h := g.W, g.H
+	src, dst := g.Data, g.Temp
+
+	parallelRows(h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			for x := 0; x < w; x++ {
+				i := y*w + x
+				center := src[i]
+				neighbor := func(nx, ny int) float32 {
+					if g.edge == edgeWrap {
+						nx = (nx + w) % w
+						ny = (ny + h) % h
+					} else if nx < 0 || nx >= w || ny < 0 || ny >= h {
+						if g.edge == edgeZero {
+							return 0
+						}
+						return center
+					}
+					j := ny*w + nx
+					if g.Obstacles != nil && g.Obstacles[j] {
+						return center
+					}
+					return src[j]
+				}
+				sum := neighbor(x-1, y) + neighbor(x+1, y) + neighbor(x, y-1) + neighbor(x, y+1)
+				dst[i] = (center + rate*(sum-4*center)) * scale
+			}
+		}
+	})
+	copy(g.Data, g.Temp)
+}
@@ -0,0 +1,122 @@
+package physarum
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func gridSum(g *Grid) float64 {
+	var sum float64
+	for _, value := range g.Data {
+		sum += float64(value)
+	}
+	return sum
+}
+
+func TestDiffusionKernels(t *testing.T) {
+	for _, kernel := range AllKernels {
+		for _, boundary := range []string{Toroidal, Reflective} {
+			g := NewGrid(33, 17, boundary, nil)
+			g.Data[8*33+16] = 1000
+			g.Diffuse(Diffusion{Kernel: kernel, Radius: 2, Passes: 3, RadiusX: 3, RadiusY: 1, Sigma: 1.5}, 1)
+			if sum := gridSum(g); math.Abs(sum-1000) > 0.01 {
+				t.Errorf("%s %s: trail not conserved, got %v", kernel, boundary, sum)
+			}
+			center := g.Data[8*33+16]
+			if center >= 1000 || center <= 0 {
+				t.Errorf("%s %s: center not spread out, got %v", kernel, boundary, center)
+			}
+			for dx := 1; dx <= 2; dx++ {
+				left, right := g.Data[8*33+16-dx], g.Data[8*33+16+dx]
+				if math.Abs(float64(left-right)) > 1e-3 {
+					t.Errorf("%s %s: not symmetric, %v != %v", kernel, boundary, left, right)
+				}
+			}
+		}
+	}
+}
+
+func TestAnisotropicBlur(t *testing.T) {
+	g := NewGrid(16, 16, Toroidal, nil)
+	g.Data[8*16+8] = 1
+	g.AnisotropicBlur(2, 0, 1, 1)
+	if g.Data[8*16+10] == 0 {
+		t.Error("trail did not spread horizontally")
+	}
+	if g.Data[9*16+8] != 0 {
+		t.Error("trail spread vertically")
+	}
+}
+
+func TestLaplacianDiffuseWalls(t *testing.T) {
+	w, h := 16, 16
+	obstacles := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		obstacles[y*w+8] = true
+	}
+	g := NewGrid(w, h, Reflective, obstacles)
+	g.Data[4*w+4] = 100
+	g.LaplacianDiffuse(0.25, 50, 1)
+	if sum := gridSum(g); math.Abs(sum-100) > 0.01 {
+		t.Errorf("trail not conserved, got %v", sum)
+	}
+	for y := 0; y < h; y++ {
+		for x := 8; x < w; x++ {
+			if g.Data[y*w+x] != 0 {
+				t.Fatalf("trail crossed the wall at %d, %d", x, y)
+			}
+		}
+	}
+
+	g = NewGrid(w, h, Absorbing, nil)
+	g.Data[0] = 100
+	g.LaplacianDiffuse(0.25, 10, 1)
+	if sum := gridSum(g); sum >= 100 {
+		t.Errorf("absorbing edges kept all the trail, got %v", sum)
+	}
+}
+
+func TestSpeciesDiffusion(t *testing.T) {
+	m := &Model{
+		BlurKernel: GaussianKernel,
+		BlurRadius: 1,
+		BlurPasses: 2,
+		BlurSigma:  1.5,
+		Configs:    []Config{{}, {BlurKernel: BoxKernel, BlurRadius: Int(4)}},
+	}
+	if got, want := m.diffusion(0), (Diffusion{Kernel: GaussianKernel, Radius: 1, Passes: 2, Sigma: 1.5}); got != want {
+		t.Errorf("species 0: got %+v, want %+v", got, want)
+	}
+	if got, want := m.diffusion(1), (Diffusion{Kernel: BoxKernel, Radius: 4, Passes: 2, Sigma: 1.5}); got != want {
+		t.Errorf("species 1: got %+v, want %+v", got, want)
+	}
+}
+
+func TestSpeciesWithoutBlur(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	configs := RandomConfigs(rnd, 3)
+	configs[1].BlurRadius = Int(0)
+	configs[2].BlurPasses = Int(0)
+	m := NewModel(16, 16, 0, 2, 2, 1, configs, RandomAttractionTable(rnd, 3), Random, Toroidal, nil, 1)
+	for c, grid := range m.Grids {
+		m.Configs[c].DecayFactor = 1
+		grid.Data[8*16+8] = 1
+	}
+	m.Step()
+	for c, grid := range m.Grids {
+		sharp := grid.Data[8*16+8] == 1 && grid.Data[8*16+9] == 0
+		if sharp != (c > 0) {
+			t.Errorf("species %d: got center %v and neighbor %v", c, grid.Data[8*16+8], grid.Data[8*16+9])
+		}
+	}
+
+	// Animating an override that was left out sets it
+	if err := m.SetTimeline([]Keyframe{{Values: map[string]float32{"Configs[0].BlurRadius": 3}}}); err != nil {
+		t.Fatal(err)
+	}
+	m.applyTimeline()
+	if got := m.diffusion(0).Radius; got != 3 {
+		t.Errorf("animated radius: got %v, want 3", got)
+	}
+}
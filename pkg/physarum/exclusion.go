@@ -0,0 +1,32 @@
+package physarum
+
+import "sync/atomic"
+
+// Count the particles in every cell, at the start of a step with exclusion.
+// Particles can share a cell when they were placed or born there, they just
+// can not move into an occupied one.
+func (m *Model) countOccupancy() {
+	if len(m.occupancy) != m.W*m.H {
+		m.occupancy = make([]int32, m.W*m.H)
+	}
+	for i := range m.occupancy {
+		m.occupancy[i] = 0
+	}
+	grid := m.Grids[0]
+	for i, x := range m.Particles.X {
+		m.occupancy[grid.Index(x, m.Particles.Y[i])]++
+	}
+}
+
+// Move a particle from cell from to cell to if nobody is there, safe to call
+// from all the particle workers at once
+func (m *Model) moveOccupant(from, to int) bool {
+	if from == to {
+		return true
+	}
+	if !atomic.CompareAndSwapInt32(&m.occupancy[to], 0, 1) {
+		return false
+	}
+	atomic.AddInt32(&m.occupancy[from], -1)
+	return true
+}
@@ -0,0 +1,176 @@
+package physarum
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+// All the supported flow fields
+const (
+	UniformFlow   = "uniform"    // The same velocity everywhere, like a steady wind
+	VortexFlow    = "vortex"     // Circling clockwise on screen around a center
+	CurlNoiseFlow = "curl_noise" // Smooth random swirls that neither gather nor spread trail
+	ImageFlow     = "image"      // Read from the red and green channels of an image
+)
+
+// All of the supported flow fields in a slice
+var AllFlows = [...]string{
+	UniformFlow,
+	VortexFlow,
+	CurlNoiseFlow,
+	ImageFlow,
+}
+
+const defaultFlowScale = 64
+
+// A vector field that pushes the particles and carries the trails along every
+// step. Velocities are in grid cells per step.
+type Flow struct {
+	Type     string  // One of AllFlows, no flow if empty
+	X        float32 // Velocity of a uniform flow
+	Y        float32 // Velocity of a uniform flow
+	CenterX  float32 // Center of a vortex, the middle of the grid if both are zero
+	CenterY  float32 // Center of a vortex, the middle of the grid if both are zero
+	Strength float32 // Fastest speed of a vortex, curl noise or image flow, negative to reverse
+	Scale    float32 // Size of the curl noise swirls in grid cells, 64 if zero
+	Seed     int64   // Seed of the curl noise
+	Image    string  // Path to a PNG, red is the X and green the Y velocity, mid gray is still
+}
+
+// A flow turned into a velocity for every cell
+type flowField struct {
+	vx []float32
+	vy []float32
+}
+
+// Replace the flow field of the model, an empty type turns it off
+func (m *Model) SetFlow(flow Flow) error {
+	w, h := m.W, m.H
+	var f *flowField
+	switch flow.Type {
+	case "":
+	case UniformFlow:
+		f = newFlowField(w, h)
+		for i := range f.vx {
+			f.vx[i] = flow.X
+			f.vy[i] = flow.Y
+		}
+	case VortexFlow:
+		cx, cy := flow.CenterX, flow.CenterY
+		if cx == 0 && cy == 0 {
+			cx, cy = float32(w)/2, float32(h)/2
+		}
+		f = newFlowField(w, h)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				dx := float32(x) + 0.5 - cx
+				dy := float32(y) + 0.5 - cy
+				r := float32(math.Hypot(float64(dx), float64(dy)))
+				if r < 1 {
+					r = 1
+				}
+				f.vx[y*w+x] = -dy / r * flow.Strength
+				f.vy[y*w+x] = dx / r * flow.Strength
+			}
+		}
+	case CurlNoiseFlow:
+		f = curlNoiseFlow(w, h, flow)
+	case ImageFlow:
+		im, err := loadImage(flow.Image)
+		if err != nil {
+			return err
+		}
+		f = newFlowField(w, h)
+		bounds := im.Bounds()
+		for y := 0; y < h; y++ {
+			sy := bounds.Min.Y + y*bounds.Dy()/h
+			for x := 0; x < w; x++ {
+				sx := bounds.Min.X + x*bounds.Dx()/w
+				c := color.NRGBA64Model.Convert(im.At(sx, sy)).(color.NRGBA64)
+				f.vx[y*w+x] = (float32(c.R)/0xffff*2 - 1) * flow.Strength
+				f.vy[y*w+x] = (float32(c.G)/0xffff*2 - 1) * flow.Strength
+			}
+		}
+	default:
+		return fmt.Errorf("unknown flow type %q", flow.Type)
+	}
+	m.Flow = flow
+	m.flow = f
+	return nil
+}
+
+func newFlowField(w, h int) *flowField {
+	return &flowField{make([]float32, w*h), make([]float32, w*h)}
+}
+
+// The curl of smooth value noise, scaled so the fastest cell moves at the strength
+func curlNoiseFlow(w, h int, flow Flow) *flowField {
+	scale := flow.Scale
+	if scale <= 0 {
+		scale = defaultFlowScale
+	}
+
+	// Random values on a lattice that wraps around, so the noise is seamless on a torus
+	nx := int(math.Ceil(float64(w) / float64(scale)))
+	ny := int(math.Ceil(float64(h) / float64(scale)))
+	rnd := rand.New(rand.NewSource(flow.Seed))
+	lattice := make([]float64, nx*ny)
+	for i := range lattice {
+		lattice[i] = rnd.Float64()
+	}
+	smooth := func(t float64) float64 { return t * t * (3 - 2*t) }
+	noise := func(x, y float64) float64 {
+		fx, fy := x*float64(nx)/float64(w), y*float64(ny)/float64(h)
+		x0, y0 := math.Floor(fx), math.Floor(fy)
+		tx, ty := smooth(fx-x0), smooth(fy-y0)
+		i0 := (int(x0)%nx + nx) % nx
+		j0 := (int(y0)%ny + ny) % ny
+		i1, j1 := (i0+1)%nx, (j0+1)%ny
+		top := lattice[j0*nx+i0]*(1-tx) + lattice[j0*nx+i1]*tx
+		bottom := lattice[j1*nx+i0]*(1-tx) + lattice[j1*nx+i1]*tx
+		return top*(1-ty) + bottom*ty
+	}
+
+	f := newFlowField(w, h)
+	var fastest float64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			px, py := float64(x)+0.5, float64(y)+0.5
+			dx := noise(px+0.5, py) - noise(px-0.5, py)
+			dy := noise(px, py+0.5) - noise(px, py-0.5)
+			f.vx[y*w+x] = float32(dy)
+			f.vy[y*w+x] = float32(-dx)
+			fastest = math.Max(fastest, math.Hypot(dx, dy))
+		}
+	}
+	if fastest > 0 {
+		k := flow.Strength / float32(fastest)
+		for i := range f.vx {
+			f.vx[i] *= k
+			f.vy[i] *= k
+		}
+	}
+	return f
+}
+
+// Velocity of the flow in grid cell i
+func (f *flowField) at(i int) (float32, float32) {
+	return f.vx[i], f.vy[i]
+}
+
+// Carry the trail along a velocity field by tracing every cell back to where
+// its trail came from
+func (g *Grid) Advect(vx, vy []float32) {
+	parallelRows(g.H, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			for x := 0; x < g.W; x++ {
+				i := y*g.W + x
+				g.Temp[i] = g.sampleBilinear(g.Data, float32(x)+0.5-vx[i], float32(y)+0.5-vy[i])
+			}
+		}
+	})
+	copy(g.Data, g.Temp)
+	g.clearObstacles()
+}
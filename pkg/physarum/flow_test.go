@@ -0,0 +1,47 @@
+package physarum
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFlow(t *testing.T) {
+	m := &Model{W: 16, H: 8, Configs: []Config{{}}}
+	m.Grids = []*Grid{NewGrid(m.W, m.H, Toroidal, nil)}
+
+	if err := m.SetFlow(Flow{Type: UniformFlow, X: 1, Y: -2}); err != nil {
+		t.Fatal(err)
+	}
+	g := m.Grids[0]
+	g.Data[4*16+3] = 1
+	g.Advect(m.flow.vx, m.flow.vy)
+	if got := g.Data[2*16+4]; got != 1 {
+		t.Errorf("uniform flow: got %v at the moved cell, want 1", got)
+	}
+
+	// Clockwise on screen, with y pointing down, so right of the center moves down
+	if err := m.SetFlow(Flow{Type: VortexFlow, Strength: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if vx, vy := m.flow.at(4*16 + 12); math.Abs(float64(vx)) > 0.25 || vy < 1.95 {
+		t.Errorf("vortex: got %v, %v, want about 0, 2", vx, vy)
+	}
+
+	if err := m.SetFlow(Flow{Type: CurlNoiseFlow, Strength: 0.5, Scale: 4, Seed: 3}); err != nil {
+		t.Fatal(err)
+	}
+	var fastest float64
+	for i := range m.flow.vx {
+		fastest = math.Max(fastest, math.Hypot(float64(m.flow.vx[i]), float64(m.flow.vy[i])))
+	}
+	if math.Abs(fastest-0.5) > 1e-4 {
+		t.Errorf("curl noise: fastest speed is %v, want 0.5", fastest)
+	}
+
+	if err := m.SetFlow(Flow{Type: "wind"}); err == nil {
+		t.Error("expected an error for an unknown flow type")
+	}
+	if err := m.SetFlow(Flow{}); err != nil || m.flow != nil {
+		t.Errorf("empty flow: got %v, %v, want no flow", m.flow, err)
+	}
+}
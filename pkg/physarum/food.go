@@ -0,0 +1,125 @@
+package physarum
+
+import (
+	"fmt"
+	"math"
+)
+
+// A source of chemoattractant ("food") that is added to some species' grids every step
+type FoodSource struct {
+	X        float32 // Center of a point source, in grid cells
+	Y        float32 // Center of a point source, in grid cells
+	Radius   float32 // Radius of a point source, in grid cells
+	Image    string  // Path to a grayscale PNG to use instead of a point, brighter pixels give more food
+	Species  []int   // Which species' grids receive the food, all of them if empty
+	Strength float32 // Amount of attractant added to a cell each step
+	Period   int     // Number of iterations in one pulse of the source, constant if less than two
+}
+
+// A food source turned into the grid cells it feeds
+type food struct {
+	source  FoodSource
+	cells   []int
+	weights []float32
+}
+
+func newFood(source FoodSource, w, h int, wrap bool, obstacles []bool) (*food, error) {
+	f := &food{source: source}
+	add := func(i int, weight float32) {
+		if weight > 0 && (obstacles == nil || !obstacles[i]) {
+			f.cells = append(f.cells, i)
+			f.weights = append(f.weights, weight)
+		}
+	}
+
+	if source.Image != "" {
+		mask, err := LoadMask(source.Image, w, h)
+		if err != nil {
+			return nil, err
+		}
+		for i, value := range mask {
+			add(i, value)
+		}
+		return f, nil
+	}
+
+	// A disc of cells around the point, at least the cell the point is in
+	r := int(math.Ceil(float64(source.Radius)))
+	cx := int(math.Floor(float64(source.X)))
+	cy := int(math.Floor(float64(source.Y)))
+	for dy := -r; dy <= r; dy++ {
+		for dx := -r; dx <= r; dx++ {
+			if float32(dx*dx+dy*dy) > source.Radius*source.Radius {
+				continue
+			}
+			x, y := cx+dx, cy+dy
+			if wrap {
+				x = (x%w + w) % w
+				y = (y%h + h) % h
+			} else if x < 0 || x >= w || y < 0 || y >= h {
+				continue
+			}
+			add(y*w+x, 1)
+		}
+	}
+	return f, nil
+}
+
+// Does this source feed species c
+func (f *food) feeds(c int) bool {
+	if len(f.source.Species) == 0 {
+		return true
+	}
+	for _, s := range f.source.Species {
+		if s == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Strength of the source at the given iteration, pulsing smoothly between zero
+// and full strength if it has a period. A period of one would stay at zero.
+func (f *food) strength(iteration int) float32 {
+	if f.source.Period <= 1 {
+		return f.source.Strength
+	}
+	t := float64(iteration%f.source.Period) / float64(f.source.Period)
+	return f.source.Strength * float32(0.5-0.5*math.Cos(2*math.Pi*t))
+}
+
+func (f *food) feed(data []float32, iteration int) {
+	amount := f.strength(iteration)
+	if amount == 0 {
+		return
+	}
+	for k, i := range f.cells {
+		data[i] += f.weights[k] * amount
+	}
+}
+
+// Replace the food sources of the model
+func (m *Model) SetFood(sources []FoodSource) error {
+	foods := make([]*food, len(sources))
+	for i, source := range sources {
+		if source.Radius < 0 {
+			return fmt.Errorf("food source %d has a negative radius", i)
+		}
+		if source.Period < 0 {
+			return fmt.Errorf("food source %d has a negative period", i)
+		}
+		for _, c := range source.Species {
+			if c < 0 || c >= len(m.Configs) {
+				return fmt.Errorf("food source %d feeds species %d, but there are only %d", i, c, len(m.Configs))
+			}
+		}
+		f, err := newFood(source, m.W, m.H, m.Grids[0].edge == edgeWrap, m.Obstacles)
+		if err != nil {
+			return err
+		}
+		foods[i] = f
+	}
+	m.Food = sources
+	m.food = foods
+	return nil
+}
@@ -0,0 +1,116 @@
+package physarum
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+func TestFoodDisc(t *testing.T) {
+	const w, h = 8, 8
+	cells := func(f *food) map[int]bool {
+		result := make(map[int]bool)
+		for _, i := range f.cells {
+			result[i] = true
+		}
+		return result
+	}
+
+	// A point source feeds the cells within the radius of the cell it is in
+	f, err := newFood(FoodSource{X: 3.5, Y: 4.2, Radius: 1}, w, h, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := cells(f)
+	for _, i := range []int{4*w + 3, 3*w + 3, 5*w + 3, 4*w + 2, 4*w + 4} {
+		if !got[i] {
+			t.Errorf("cell %d, %d gets no food", i%w, i/w)
+		}
+	}
+	if len(got) != 5 {
+		t.Errorf("got %d cells, want 5", len(got))
+	}
+
+	// A zero radius still feeds the cell the point is in
+	f, _ = newFood(FoodSource{X: 1, Y: 1}, w, h, false, nil)
+	if len(f.cells) != 1 || f.cells[0] != w+1 {
+		t.Errorf("zero radius: got cells %v, want [%d]", f.cells, w+1)
+	}
+
+	// Past the edge the disc wraps on a torus and is cut off otherwise
+	f, _ = newFood(FoodSource{X: 0, Y: 0, Radius: 1}, w, h, false, nil)
+	if len(f.cells) != 3 {
+		t.Errorf("cut off: got %d cells, want 3", len(f.cells))
+	}
+	f, _ = newFood(FoodSource{X: 0, Y: 0, Radius: 1}, w, h, true, nil)
+	if got := cells(f); len(got) != 5 || !got[(h-1)*w] || !got[w-1] {
+		t.Errorf("wrapped: got cells %v", f.cells)
+	}
+
+	// Walls get no food
+	obstacles := make([]bool, w*h)
+	obstacles[4*w+4] = true
+	f, _ = newFood(FoodSource{X: 3.5, Y: 4.2, Radius: 1}, w, h, false, obstacles)
+	if got := cells(f); len(got) != 4 || got[4*w+4] {
+		t.Errorf("walls: got cells %v", f.cells)
+	}
+}
+
+func TestFoodPulse(t *testing.T) {
+	f := &food{source: FoodSource{Strength: 2, Period: 8}}
+	for iteration, want := range map[int]float32{0: 0, 2: 1, 4: 2, 6: 1, 8: 0, 12: 2} {
+		if got := f.strength(iteration); math.Abs(float64(got-want)) > 1e-6 {
+			t.Errorf("iteration %d: got %v, want %v", iteration, got, want)
+		}
+	}
+
+	for _, period := range []int{0, 1} {
+		f = &food{source: FoodSource{Strength: 2, Period: period}}
+		for _, iteration := range []int{0, 1, 7} {
+			if got := f.strength(iteration); got != 2 {
+				t.Errorf("period %d, iteration %d: got %v, want 2", period, iteration, got)
+			}
+		}
+	}
+}
+
+func TestFoodSpecies(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	m := NewModel(16, 16, 0, 1, 0, 1, RandomConfigs(rnd, 3), RandomAttractionTable(rnd, 3), Random, Toroidal, nil, 1)
+	for c := range m.Configs {
+		m.Configs[c].DecayFactor = 1
+	}
+	if err := m.SetFood([]FoodSource{{X: 8, Y: 8, Strength: 1, Species: []int{1}}}); err != nil {
+		t.Fatal(err)
+	}
+	m.Step()
+	for c, grid := range m.Grids {
+		want := float32(0)
+		if c == 1 {
+			want = 1
+		}
+		if got := grid.Data[8*16+8]; got != want {
+			t.Errorf("grid %d: got %v, want %v", c, got, want)
+		}
+	}
+}
+
+func TestSetFoodErrors(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	m := NewModel(16, 16, 0, 1, 0, 1, RandomConfigs(rnd, 2), RandomAttractionTable(rnd, 2), Random, Toroidal, nil, 1)
+	for _, source := range []FoodSource{
+		{Species: []int{2}},
+		{Species: []int{-1}},
+		{Radius: -1},
+		{Period: -5},
+		{Image: filepath.Join(t.TempDir(), "missing.png")},
+	} {
+		if err := m.SetFood([]FoodSource{{}, source}); err == nil {
+			t.Errorf("%+v: expected an error", source)
+		}
+	}
+	if m.Food != nil {
+		t.Error("a failed SetFood replaced the food sources")
+	}
+}
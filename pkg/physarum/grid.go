@@ -5,36 +5,100 @@ import (
 )
 
 type Grid struct {
-	W    int
-	H    int
+	W int
+	H int
+
+	// Trail and scratch buffer, W*H cells each. Both are nil in grids of a
+	// model with Float16Grids, except while the model steps, use
+	// CopySnapshot or Model.Data to read those.
 	Data []float32
 	Temp []float32
+
+	// Cells that trail can not spread into, shared by all grids of a model
+	Obstacles []bool
+
+	// Optional per cell multiplier of the decay factor
+	DecayMap []float32
+
+	// Half float storage of Data and Temp with Float16Grids
+	data16 []uint16
+	temp16 []uint16
+
+	edge edgeMode
+	pow2 bool // Both dimensions are powers of two, wrap with a mask instead of a modulo
 }
 
-func NewGrid(w, h int) *Grid {
-	if !IsPowerOfTwo(w) || !IsPowerOfTwo(h) {
-		log.Fatal("grid dimensions must be a power of two")
+func NewGrid(w, h int, boundary string, obstacles []bool) *Grid {
+	return newGrid(w, h, boundary, obstacles, Float32Grids)
+}
+
+func newGrid(w, h int, boundary string, obstacles []bool, precision string) *Grid {
+	if w < 1 || h < 1 {
+		log.Fatal("grid dimensions must be positive")
 	}
-	data := make([]float32, w*h)
-	temp := make([]float32, w*h)
-	for i := range data {
-		data[i] = 0.0 //01 //rand.Float32()
+	pow2 := IsPowerOfTwo(w) && IsPowerOfTwo(h)
+	g := &Grid{W: w, H: h, Obstacles: obstacles, edge: boundaryEdgeMode(boundary), pow2: pow2}
+	if isHalf(precision) {
+		g.data16 = make([]uint16, w*h)
+		g.temp16 = make([]uint16, w*h)
+	} else {
+		g.Data = make([]float32, w*h)
+		g.Temp = make([]float32, w*h)
 	}
-	return &Grid{w, h, data, temp}
+	return g
 }
 
 func (g *Grid) Index(x, y float32) int {
-	i := int(x+float32(g.W)) & (g.W - 1)
-	j := int(y+float32(g.H)) & (g.H - 1)
+	if g.edge != edgeWrap {
+		// Past the edge is the nearest edge cell, though absorbing grids read as
+		// zero there, see outside
+		i := int(x)
+		j := int(y)
+		if x < 0 {
+			i = 0
+		} else if i >= g.W {
+			i = g.W - 1
+		}
+		if y < 0 {
+			j = 0
+		} else if j >= g.H {
+			j = g.H - 1
+		}
+		return j*g.W + i
+	}
+	if g.pow2 {
+		i := int(x+float32(g.W)) & (g.W - 1)
+		j := int(y+float32(g.H)) & (g.H - 1)
+		return j*g.W + i
+	}
+	i := int(x+float32(g.W)) % g.W
+	j := int(y+float32(g.H)) % g.H
+	if i < 0 {
+		i += g.W
+	}
+	if j < 0 {
+		j += g.H
+	}
 	return j*g.W + i
 }
 
+// Is x, y past the edge of an absorbing grid, where sensors read nothing
+func (g *Grid) outside(x, y float32) bool {
+	return g.edge == edgeZero && (x < 0 || y < 0 || x >= float32(g.W) || y >= float32(g.H))
+}
+
 func (g *Grid) Get(x, y float32) float32 {
-	return g.Data[g.Index(x, y)]
+	if g.outside(x, y) {
+		return 0
+	}
+	return g.dataAt(g.Index(x, y))
 }
 
 func (g *Grid) GetTemp(x, y float32) float32 {
-	return g.Temp[g.Index(x, y)]
+	if g.outside(x, y) {
+		return 0
+	}
+	return g.tempAt(g.Index(x, y))
 }
 
 func (g *Grid) Add(x, y, a float32) {
@@ -42,14 +106,54 @@ func (g *Grid) Add(x, y, a float32) {
 }
 
 func (g *Grid) BoxBlur(radius, iterations int, decayFactor float32) {
+	g.AnisotropicBlur(radius, radius, iterations, decayFactor)
+}
+
+// Box blur with a horizontal radius rx and a vertical radius ry
+func (g *Grid) AnisotropicBlur(rx, ry, iterations int, decayFactor float32) {
 	if iterations < 1 {
 		for i := range g.Data {
 			g.Data[i] *= decayFactor
 		}
+		g.clearObstacles()
+		g.decayMap()
 		return
 	}
 	for i := 1; i < iterations; i++ {
-		boxBlur(g.Data, g.Temp, g.W, g.H, radius, 1)
+		g.boxBlur(rx, ry, 1)
+	}
+	g.boxBlur(rx, ry, decayFactor)
+	g.decayMap()
+}
+
+// One pass of the box blur, which keeps to the open cells if there are walls
+func (g *Grid) boxBlur(rx, ry int, scale float32) {
+	if g.Obstacles == nil {
+		boxBlur(g.Data, g.Temp, g.W, g.H, rx, ry, scale, g.edge)
+		return
+	}
+	blurH := boxStretch(rx, 1/float32(rx+rx+1))
+	blurV := boxStretch(ry, scale/float32(ry+ry+1))
+	wallBlur(g.Data, g.Temp, g.W, g.H, g.Obstacles, g.edge, blurH, blurV)
+}
+
+func (g *Grid) decayMap() {
+	if g.DecayMap == nil {
+		return
+	}
+	for i, scale := range g.DecayMap {
+		g.Data[i] *= scale
+	}
+}
+
+// Remove any trail that ended up in a wall
+func (g *Grid) clearObstacles() {
+	if g.Obstacles == nil {
+		return
+	}
+	for i, wall := range g.Obstacles {
+		if wall {
+			g.Data[i] = 0
+		}
 	}
-	boxBlur(g.Data, g.Temp, g.W, g.H, radius, decayFactor)
 }
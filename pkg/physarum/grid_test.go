@@ -0,0 +1,149 @@
+package physarum
+
+import (
+	"testing"
+)
+
+func TestGridIndexWraps(t *testing.T) {
+	for _, size := range [][2]int{{64, 32}, {60, 34}} {
+		g := NewGrid(size[0], size[1], Toroidal, nil)
+		w, h := float32(g.W), float32(g.H)
+		cases := []struct {
+			x, y float32
+			i, j int
+		}{
+			{0, 0, 0, 0},
+			{w - 0.5, h - 0.5, g.W - 1, g.H - 1},
+			{-0.5, -0.5, g.W - 1, g.H - 1},
+			{w + 1.5, 2.5, 1, 2},
+			{3, h + 4, 3, 4},
+		}
+		for _, c := range cases {
+			if got, want := g.Index(c.x, c.y), c.j*g.W+c.i; got != want {
+				t.Fatalf("%dx%d: Index(%v, %v) = %v, want %v", g.W, g.H, c.x, c.y, got, want)
+			}
+		}
+	}
+}
+
+func TestGridBilinear(t *testing.T) {
+	for _, boundary := range AllBoundaries {
+		g := NewGrid(6, 5, boundary, nil)
+		for i := range g.Temp {
+			g.Temp[i] = float32(i)
+		}
+		// At a cell center it is the cell itself, between centers the average
+		if got := g.GetTempBilinear(2.5, 3.5); got != g.Temp[3*6+2] {
+			t.Errorf("%s: center got %v, want %v", boundary, got, g.Temp[3*6+2])
+		}
+		if got, want := g.GetTempBilinear(3, 3.5), (g.Temp[3*6+2]+g.Temp[3*6+3])/2; got != want {
+			t.Errorf("%s: between got %v, want %v", boundary, got, want)
+		}
+
+		for _, p := range [][2]float32{{3, 3}, {0.1, 0.2}, {5.9, 4.9}} {
+			for i := range g.Data {
+				g.Data[i] = 0
+			}
+			g.AddBilinear(p[0], p[1], 4)
+			var sum float32
+			for _, value := range g.Data {
+				sum += value
+			}
+			want := float32(4)
+			if boundary == Absorbing && p[0] != 3 {
+				want = 4 * (1 - bilinearLoss(p[0], 6)) * (1 - bilinearLoss(p[1], 5))
+			}
+			if sum < want-0.001 || sum > want+0.001 {
+				t.Errorf("%s: deposit at %v sums to %v, want %v", boundary, p, sum, want)
+			}
+		}
+	}
+}
+
+// Share of a bilinear splat at x that lands past the edges of a line n cells long
+func bilinearLoss(x float32, n int) float32 {
+	if x < 0.5 {
+		return 0.5 - x
+	}
+	if x > float32(n)-0.5 {
+		return x - (float32(n) - 0.5)
+	}
+	return 0
+}
+
+func TestAbsorbingSensors(t *testing.T) {
+	g := NewGrid(4, 4, Absorbing, nil)
+	for i := range g.Temp {
+		g.Temp[i] = 1
+		g.Data[i] = 1
+	}
+	for _, p := range [][2]float32{{-0.5, 2}, {2, -3}, {4.5, 2}, {2, 4}} {
+		if got := g.GetTemp(p[0], p[1]); got != 0 {
+			t.Errorf("GetTemp%v: got %v, want 0", p, got)
+		}
+		if got := g.Get(p[0], p[1]); got != 0 {
+			t.Errorf("Get%v: got %v, want 0", p, got)
+		}
+	}
+	if got := g.GetTemp(3.9, 0); got != 1 {
+		t.Errorf("inside: got %v, want 1", got)
+	}
+	// Half way out of the grid, half of the sample is outside
+	if got := g.GetTempBilinear(0, 2); got != 0.5 {
+		t.Errorf("bilinear at the edge: got %v, want 0.5", got)
+	}
+	if got := g.GetTempBilinear(-1, 2); got != 0 {
+		t.Errorf("bilinear past the edge: got %v, want 0", got)
+	}
+}
+
+func benchmarkGrid() (*Grid, []float32) {
+	g := NewGrid(1024, 1024, Toroidal, nil)
+	points := make([]float32, 1<<16)
+	for i := range points {
+		points[i] = float32(i*7919%1024) + float32(i%13)/13
+	}
+	return g, points
+}
+
+func BenchmarkGetTemp(b *testing.B) {
+	g, points := benchmarkGrid()
+	var sum float32
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		k := i & (len(points) - 2)
+		sum += g.GetTemp(points[k], points[k+1])
+	}
+	result = []float32{sum}
+}
+
+func BenchmarkGetTempBilinear(b *testing.B) {
+	g, points := benchmarkGrid()
+	var sum float32
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		k := i & (len(points) - 2)
+		sum += g.GetTempBilinear(points[k], points[k+1])
+	}
+	result = []float32{sum}
+}
+
+func BenchmarkAdd(b *testing.B) {
+	g, points := benchmarkGrid()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		k := i & (len(points) - 2)
+		g.Add(points[k], points[k+1], 1)
+	}
+	result = g.Data
+}
+
+func BenchmarkAddBilinear(b *testing.B) {
+	g, points := benchmarkGrid()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		k := i & (len(points) - 2)
+		g.AddBilinear(points[k], points[k+1], 1)
+	}
+	result = g.Data
+}
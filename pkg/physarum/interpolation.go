@@ -0,0 +1,120 @@
+package physarum
+
+import (
+	"log"
+	"math"
+)
+
+// All the supported ways of reading and writing the grids between cell centers
+const (
+	NearestInterpolation  = "nearest"  // Sensors read and particles deposit into the cell they are in
+	BilinearInterpolation = "bilinear" // Sensors blend and deposits spread over the four nearest cells
+)
+
+// All of the supported interpolations in a slice
+var AllInterpolations = [...]string{
+	NearestInterpolation,
+	BilinearInterpolation,
+}
+
+// Does the interpolation mode blend between cells, log.Fatal if it is unknown
+func isBilinear(interpolation string) bool {
+	switch interpolation {
+	case NearestInterpolation, "":
+		return false
+	case BilinearInterpolation:
+		return true
+	}
+	log.Fatalf("unknown interpolation %q", interpolation)
+	return false
+}
+
+// Index of the cell at column i and row j, treating the ones outside of the
+// grid the same way Index does
+func (g *Grid) cellIndex(i, j int) int {
+	if g.edge != edgeWrap {
+		if i < 0 {
+			i = 0
+		} else if i >= g.W {
+			i = g.W - 1
+		}
+		if j < 0 {
+			j = 0
+		} else if j >= g.H {
+			j = g.H - 1
+		}
+		return j*g.W + i
+	}
+	if g.pow2 {
+		return (j&(g.H-1))*g.W + i&(g.W-1)
+	}
+	i %= g.W
+	j %= g.H
+	if i < 0 {
+		i += g.W
+	}
+	if j < 0 {
+		j += g.H
+	}
+	return j*g.W + i
+}
+
+// The four cells whose centers surround x, y and the weights of the top left,
+// top right, bottom left and bottom right ones. Cells past the edge of an
+// absorbing grid weigh nothing, so sensors read them as zero and deposits
+// into them are lost.
+func (g *Grid) bilinear(x, y float32) (i00, i10, i01, i11 int, w00, w10, w01, w11 float32) {
+	fx := float64(x) - 0.5
+	fy := float64(y) - 0.5
+	x0 := math.Floor(fx)
+	y0 := math.Floor(fy)
+	tx := float32(fx - x0)
+	ty := float32(fy - y0)
+	i, j := int(x0), int(y0)
+	i00 = g.cellIndex(i, j)
+	i10 = g.cellIndex(i+1, j)
+	i01 = g.cellIndex(i, j+1)
+	i11 = g.cellIndex(i+1, j+1)
+	w00 = (1 - tx) * (1 - ty)
+	w10 = tx * (1 - ty)
+	w01 = (1 - tx) * ty
+	w11 = tx * ty
+	if g.edge == edgeZero {
+		if i < 0 || i >= g.W {
+			w00, w01 = 0, 0
+		}
+		if i+1 < 0 || i+1 >= g.W {
+			w10, w11 = 0, 0
+		}
+		if j < 0 || j >= g.H {
+			w00, w10 = 0, 0
+		}
+		if j+1 < 0 || j+1 >= g.H {
+			w01, w11 = 0, 0
+		}
+	}
+	return
+}
+
+// Like GetTemp, but blended between the four nearest cell centers
+func (g *Grid) GetTempBilinear(x, y float32) float32 {
+	if g.Temp == nil {
+		i00, i10, i01, i11, w00, w10, w01, w11 := g.bilinear(x, y)
+		return g.tempAt(i00)*w00 + g.tempAt(i10)*w10 + g.tempAt(i01)*w01 + g.tempAt(i11)*w11
+	}
+	return g.sampleBilinear(g.Temp, x, y)
+}
+
+func (g *Grid) sampleBilinear(data []float32, x, y float32) float32 {
+	i00, i10, i01, i11, w00, w10, w01, w11 := g.bilinear(x, y)
+	return data[i00]*w00 + data[i10]*w10 + data[i01]*w01 + data[i11]*w11
+}
+
+// Like Add, but spread over the four nearest cell centers
+func (g *Grid) AddBilinear(x, y, a float32) {
+	i00, i10, i01, i11, w00, w10, w01, w11 := g.bilinear(x, y)
+	g.Data[i00] += a * w00
+	g.Data[i10] += a * w10
+	g.Data[i01] += a * w01
+	g.Data[i11] += a * w11
+}
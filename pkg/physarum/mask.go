@@ -0,0 +1,53 @@
+package physarum
+
+import (
+	"image"
+	"image/color"
+	_ "image/png"
+	"os"
+)
+
+// Read a grayscale version of an image, resampled to w x h with nearest
+// neighbor sampling, values are in [0, 1] with 0 for black
+func LoadMask(path string, w, h int) ([]float32, error) {
+	im, err := loadImage(path)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := im.Bounds()
+	mask := make([]float32, w*h)
+	for y := 0; y < h; y++ {
+		sy := bounds.Min.Y + y*bounds.Dy()/h
+		for x := 0; x < w; x++ {
+			sx := bounds.Min.X + x*bounds.Dx()/w
+			gray := color.Gray16Model.Convert(im.At(sx, sy)).(color.Gray16)
+			mask[y*w+x] = float32(gray.Y) / 0xffff
+		}
+	}
+	return mask, nil
+}
+
+func loadImage(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	im, _, err := image.Decode(file)
+	return im, err
+}
+
+// Read an obstacle mask for a w x h grid, dark pixels are walls
+func LoadObstacles(path string, w, h int) ([]bool, error) {
+	mask, err := LoadMask(path, w, h)
+	if err != nil {
+		return nil, err
+	}
+	obstacles := make([]bool, len(mask))
+	for i, value := range mask {
+		obstacles[i] = value < 0.5
+	}
+	return obstacles, nil
+}
@@ -0,0 +1,175 @@
+package physarum
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestImage(t *testing.T, im image.Image) string {
+	path := filepath.Join(t.TempDir(), "mask.png")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, im); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadObstacles(t *testing.T) {
+	// Left half black, right half white, with a dark gray and a light gray pixel
+	im := image.NewGray(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		im.SetGray(2, y, color.Gray{255})
+		im.SetGray(3, y, color.Gray{255})
+	}
+	im.SetGray(2, 1, color.Gray{100})
+	im.SetGray(1, 1, color.Gray{150})
+	path := writeTestImage(t, im)
+
+	obstacles, err := LoadObstacles(path, 8, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			// Each pixel covers 2 x 2 cells, the dark ones are walls
+			want := im.GrayAt(x/2, y/2).Y < 128
+			if obstacles[y*8+x] != want {
+				t.Errorf("cell %d, %d: got %v, want %v", x, y, obstacles[y*8+x], want)
+			}
+		}
+	}
+
+	if _, err := LoadObstacles(filepath.Join(t.TempDir(), "missing.png"), 8, 4); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestClearObstacles(t *testing.T) {
+	g := NewGrid(4, 1, Toroidal, []bool{false, true, true, false})
+	for i := range g.Data {
+		g.Data[i] = 1
+	}
+	g.clearObstacles()
+	for i, want := range []float32{1, 0, 0, 1} {
+		if g.Data[i] != want {
+			t.Errorf("cell %d: got %v, want %v", i, g.Data[i], want)
+		}
+	}
+
+	g = NewGrid(4, 1, Toroidal, nil)
+	g.Data[1] = 1
+	g.clearObstacles()
+	if g.Data[1] != 1 {
+		t.Error("a grid without obstacles lost trail")
+	}
+}
+
+func TestObstacles(t *testing.T) {
+	const w, h = 64, 64
+	obstacles := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 28; x < 36; x++ {
+			obstacles[y*w+x] = true
+		}
+	}
+	rnd := rand.New(rand.NewSource(1))
+	configs := RandomConfigs(rnd, 2)
+	table := RandomAttractionTable(rnd, 2)
+	for _, interpolation := range AllInterpolations {
+		for _, passes := range []int{0, 2} {
+			m := NewModel(w, h, 2000, 1, passes, 1, configs, table, Random, Toroidal, obstacles, 3)
+			m.Interpolation = interpolation
+			for step := 0; step < 20; step++ {
+				m.Step()
+				for i := 0; i < m.Particles.Len(); i++ {
+					if m.isWall(m.Particles.X[i], m.Particles.Y[i]) {
+						t.Fatalf("%s, %d passes, step %d: particle %d is in a wall", interpolation, passes, step, i)
+					}
+				}
+				for c, grid := range m.Grids {
+					for i, wall := range obstacles {
+						if wall && grid.Data[i] != 0 {
+							t.Fatalf("%s, %d passes, step %d: grid %d has %v in wall cell %d", interpolation, passes, step, c, grid.Data[i], i)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestThinWalls(t *testing.T) {
+	const w, h = 16, 12
+	// One cell thin walls across the grid at x = 4 and 12, or y = 3 and 9, so
+	// the trail between them can not get out even around the wrapping edges
+	for _, vertical := range []bool{true, false} {
+		walls := make([]bool, w*h)
+		inside := func(x, y int) bool {
+			if vertical {
+				return x > 4 && x < 12
+			}
+			return y > 3 && y < 9
+		}
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				if vertical && (x == 4 || x == 12) || !vertical && (y == 3 || y == 9) {
+					walls[y*w+x] = true
+				}
+			}
+		}
+		diffusions := []Diffusion{
+			{Kernel: BoxKernel, Radius: 3, Passes: 4},
+			{Kernel: AnisotropicKernel, RadiusX: 5, RadiusY: 4, Passes: 2},
+			{Kernel: GaussianKernel, Sigma: 2},
+		}
+		for _, boundary := range AllBoundaries {
+			for _, d := range diffusions {
+				g := NewGrid(w, h, boundary, walls)
+				g.Data[6*w+8] = 100
+				g.Diffuse(d, 1)
+				for y := 0; y < h; y++ {
+					for x := 0; x < w; x++ {
+						if value := g.Data[y*w+x]; !inside(x, y) && value != 0 {
+							t.Fatalf("vertical %v, %s, %s: trail %v got through to %d, %d", vertical, boundary, d.Kernel, value, x, y)
+						}
+					}
+				}
+				if g.Data[6*w+10] == 0 || g.Data[5*w+8] == 0 {
+					t.Errorf("vertical %v, %s, %s: the trail did not spread", vertical, boundary, d.Kernel)
+				}
+			}
+		}
+	}
+}
+
+func TestOpenWallBlur(t *testing.T) {
+	// With no walls in it, a wall mask changes nothing
+	const w, h = 20, 14
+	for _, boundary := range AllBoundaries {
+		for _, d := range []Diffusion{{Kernel: AnisotropicKernel, RadiusX: 2, RadiusY: 3, Passes: 2}, {Kernel: GaussianKernel, Sigma: 1.5}} {
+			a := NewGrid(w, h, boundary, nil)
+			b := NewGrid(w, h, boundary, make([]bool, w*h))
+			for i := range a.Data {
+				a.Data[i] = float32(i % 7)
+				b.Data[i] = a.Data[i]
+			}
+			a.Diffuse(d, 0.5)
+			b.Diffuse(d, 0.5)
+			for i := range a.Data {
+				if math.Abs(float64(a.Data[i]-b.Data[i])) > 1e-4 {
+					t.Fatalf("%s, %s: got %v, want %v at %d", boundary, d.Kernel, b.Data[i], a.Data[i], i)
+				}
+			}
+		}
+	}
+}
@@ -32,8 +32,8 @@ var AllInitTypes = [...]string{
 }
 
 // Pick a random init type from above
-func RandomInitType() string {
-	return AllInitTypes[rand.Intn(len(AllInitTypes))]
+func RandomInitType(rnd *rand.Rand) string {
+	return AllInitTypes[rnd.Intn(len(AllInitTypes))]
 }
 
 type Model struct {
@@ -43,23 +43,91 @@ type Model struct {
 	BlurRadius int
 	BlurPasses int
 
+	BlurKernel    string  // How trail spreads out, see Diffusion
+	BlurSigma     float32 // Standard deviation of the gaussian kernel
+	DiffusionRate float32 // Diffusion coefficient of the laplacian kernel
+	BlurRadiusX   int     // Horizontal radius of the anisotropic kernel
+	BlurRadiusY   int     // Vertical radius of the anisotropic kernel
+
+	Interpolation string // How sensors read and particles deposit, see AllInterpolations
+
+	GridPrecision string       // How the grids are stored, see AllGridPrecisions
+	work          [2][]float32 // Buffers half float grids are expanded into
+
+	// Sensors sum the grids of all species where they read, instead of
+	// combining whole grids first, which is cheaper with far fewer particles
+	// than cells
+	FusedSensing bool
+	attraction   [][]attractionTerm // Factors of the attraction table that matter, per step
+
 	ZoomFactor float32
 
 	Configs         []Config
 	AttractionTable [][]float32
+	steerings       []Steering // Per species, see UpdateSteerings
+
+	ConversionTable     [][]float32 // Chances of switching species, see SetConversion
+	ConversionThreshold float32
 
 	Grids     []*Grid
-	Particles []Particle
+	Particles Particles
 
 	Iteration int
 
-	InitType string
+	InitType     string
+	Boundary     string
+	Obstacles    []bool // Cells that are walls, nil if there are none
+	ObstacleMask string // Image the walls were read from, empty if they were given directly
+
+	Food []FoodSource
+	food []*food
+
+	Flow Flow // Vector field that pushes particles and trails, see SetFlow
+	flow *flowField
+
+	Keyframes []Keyframe // Parameter animation, see SetTimeline
+	timeline  []*track
+
+	parameterScales []*parameterScales // Per species, from the configs' ParameterMaps
+
+	// Cap on the total number of particles when species divide, no cap if zero
+	MaxParticles int
+
+	// Particle randomness only depends on the seed, iteration and particle
+	// index, so runs reproduce exactly regardless of the number of CPUs
+	Deterministic bool
+
+	// At most one particle moves into a cell, blocked particles turn randomly
+	// instead of moving as in the Jones model. Which of two particles gets a
+	// cell depends on the timing of the workers, unless Deterministic, which
+	// then moves the particles with a single worker.
+	Exclusion bool
+	occupancy []int32 // Number of particles in each cell, with exclusion
+
+	numParticles int // Total number of particles asked for, split between the species by StartOver
+
+	seed    int64
+	rnd     *rand.Rand // Reseeded from seed by StartOver, so restarts are reproducible
+	workers int        // Number of particle workers, runtime.NumCPU() if zero
 
-	seed int64
+	population []populationChanges // Per worker buffers for births and deaths
+	deposits   depositBuffers
+
+	snapshots    [2]Snapshot // Reused by CopySnapshot, taking turns
+	nextSnapshot int
 }
 
 func MakeModel(settings *Settings) *Model {
-	model := NewModel(
+	var obstacles []bool
+	if settings.ObstacleMask != "" {
+		var err error
+		obstacles, err = LoadObstacles(settings.ObstacleMask, settings.Width, settings.Height)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	model := newModel(
 		settings.Width,
 		settings.Height,
 		settings.Particles,
@@ -69,8 +137,36 @@ func MakeModel(settings *Settings) *Model {
 		settings.Configs,
 		settings.AttractionTable,
 		settings.InitType,
+		settings.Boundary,
+		obstacles,
 		settings.Seed,
 	)
+	model.ObstacleMask = settings.ObstacleMask
+	model.GridPrecision = settings.GridPrecision
+	model.StartOver()
+	if err := model.SetFood(settings.Food); err != nil {
+		log.Fatal(err)
+	}
+	if err := model.SetFlow(settings.Flow); err != nil {
+		log.Fatal(err)
+	}
+	model.Deterministic = settings.Deterministic
+	model.SetCompactAngles(settings.CompactAngles)
+	model.Exclusion = settings.Exclusion
+	model.BlurKernel = settings.BlurKernel
+	model.BlurSigma = settings.BlurSigma
+	model.DiffusionRate = settings.DiffusionRate
+	model.BlurRadiusX = settings.BlurRadiusX
+	model.BlurRadiusY = settings.BlurRadiusY
+	model.Interpolation = settings.Interpolation
+	model.FusedSensing = settings.FusedSensing
+	model.MaxParticles = settings.MaxParticles
+	if err := model.SetConversion(settings.ConversionTable, settings.ConversionThreshold); err != nil {
+		log.Fatal(err)
+	}
+	if err := model.SetTimeline(settings.Timeline); err != nil {
+		log.Fatal(err)
+	}
 
 	log.Println("********************")
 	PrintConfigs(model.Configs, model.AttractionTable)
@@ -82,243 +178,381 @@ func MakeModel(settings *Settings) *Model {
 
 func NewModel(
 	w, h, numParticles, blurRadius, blurPasses int, zoomFactor float32,
-	configs []Config, attractionTable [][]float32, initType string, seed int64) *Model {
+	configs []Config, attractionTable [][]float32, initType, boundary string,
+	obstacles []bool, seed int64) *Model {
+
+	m := newModel(w, h, numParticles, blurRadius, blurPasses, zoomFactor,
+		configs, attractionTable, initType, boundary, obstacles, seed)
+	m.StartOver()
+	return m
+}
+
+// Seed of the random numbers of the model, which StartOver starts over from
+func (m *Model) Seed() int64 {
+	return m.seed
+}
+
+// Like NewModel, but without the grids and particles, which StartOver creates
+func newModel(
+	w, h, numParticles, blurRadius, blurPasses int, zoomFactor float32,
+	configs []Config, attractionTable [][]float32, initType, boundary string,
+	obstacles []bool, seed int64) *Model {
 
 	grids := make([]*Grid, len(configs))
-	numParticlesPerConfig := int(math.Ceil(
-		float64(numParticles) / float64(len(configs))))
-	actualNumParticles := numParticlesPerConfig * len(configs)
-	particles := make([]Particle, actualNumParticles)
+	counts, err := ParticleCounts(numParticles, configs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	actualNumParticles := 0
+	for _, count := range counts {
+		actualNumParticles += count
+	}
+	particles := newParticles(actualNumParticles, false)
 	m := &Model{
-		w, h, blurRadius, blurPasses, zoomFactor,
-		configs, attractionTable, grids, particles, 0, initType, seed}
-	m.StartOver()
+		W:               w,
+		H:               h,
+		BlurRadius:      blurRadius,
+		BlurPasses:      blurPasses,
+		ZoomFactor:      zoomFactor,
+		Configs:         configs,
+		AttractionTable: attractionTable,
+		Grids:           grids,
+		Particles:       particles,
+		InitType:        initType,
+		Boundary:        boundary,
+		Obstacles:       obstacles,
+		numParticles:    numParticles,
+		seed:            seed,
+	}
+	if err := m.UpdateSteerings(); err != nil {
+		log.Fatal(err)
+	}
+	if err := m.LoadParameterMaps(); err != nil {
+		log.Fatal(err)
+	}
 	return m
 }
 
 func (m *Model) StartOver() {
-	numParticlesPerConfig := len(m.Particles) / len(m.Configs)
-	m.Particles = m.Particles[:0]
+	counts, err := ParticleCounts(m.numParticles, m.Configs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	m.Particles.Truncate(0)
 	m.Iteration = 0
+	m.rnd = rand.New(rand.NewSource(m.seed))
 	for c := range m.Configs {
-		m.Grids[c] = NewGrid(m.W, m.H)
-		for i := 0; i < numParticlesPerConfig; i++ {
-			var x, y, a float32
-			switch m.InitType {
-			case Random:
-				x = rand.Float32() * float32(m.W)
-				y = rand.Float32() * float32(m.H)
-				a = rand.Float32() * 2 * math.Pi
-			case Point:
-				x = float32(m.W) / 2
-				y = float32(m.H) / 2
-				a = rand.Float32() * 2 * math.Pi
-			case RandomCircleRandom:
-				a = rand.Float32() * 2 * math.Pi
-				circle_radius_fraction := 0.25
-				r := circle_radius_fraction * math.Min(float64(m.H), float64(m.W)) * math.Sqrt(rand.Float64())
-				x_tmp, y_tmp := math.Sincos(float64(a))
-				x = float32(r*x_tmp) + float32(m.W)/2
-				y = float32(r*y_tmp) + float32(m.H)/2
-				a = rand.Float32() * 2 * math.Pi
-			case RandomCircleOut:
-				a = rand.Float32() * 2 * math.Pi
-				circle_radius_fraction := 0.25
-				r := circle_radius_fraction * math.Min(float64(m.H), float64(m.W)) * math.Sqrt(rand.Float64())
-				y_tmp, x_tmp := math.Sincos(float64(a))
-				x = float32(r*x_tmp) + float32(m.W)/2
-				y = float32(r*y_tmp) + float32(m.H)/2
-			case RandomCircleIn:
-				a = rand.Float32() * 2 * math.Pi
-				circle_radius_fraction := 0.25
-				r := circle_radius_fraction * math.Min(float64(m.H), float64(m.W)) * math.Sqrt(rand.Float64())
-				y_tmp, x_tmp := math.Sincos(float64(a))
-				x = float32(r*x_tmp) + float32(m.W)/2
-				y = float32(r*y_tmp) + float32(m.H)/2
-				a_tmp := float64(a + math.Pi)
-				a = float32(math.Atan2(math.Sin(a_tmp), math.Cos(a_tmp)))
-			case RandomCircleCW:
-				a = rand.Float32() * 2 * math.Pi
-				circle_radius_fraction := 0.25
-				r := circle_radius_fraction * math.Min(float64(m.H), float64(m.W)) * math.Sqrt(rand.Float64())
-				y_tmp, x_tmp := math.Sincos(float64(a))
-				x = float32(r*x_tmp) + float32(m.W)/2
-				y = float32(r*y_tmp) + float32(m.H)/2
-				a_tmp := float64(a + math.Pi/2.0)
-				a = float32(math.Atan2(math.Sincos(a_tmp)))
-			case RandomCircleQuads:
-				a = rand.Float32() * 2 * math.Pi
-				circle_radius_fraction := 0.25
-				r := circle_radius_fraction * math.Min(float64(m.H), float64(m.W)) * math.Sqrt(rand.Float64())
-				x_tmp, y_tmp := math.Sincos(float64(a))
-				x = float32(r*x_tmp) + float32(m.W)/2
-				y = float32(r*y_tmp) + float32(m.H)/2
-			}
-			if false { // for testing, it is a LOT...
-				fmt.Println(x-float32(m.W)/2, y-float32(m.H)/2, a)
-			}
-			p := Particle{x, y, a, uint32(c)}
-			m.Particles = append(m.Particles, p)
+		m.Grids[c] = newGrid(m.W, m.H, m.Boundary, m.Obstacles, m.GridPrecision)
+	}
+	m.setDecayMaps()
+	for c := range m.Configs {
+		for i := 0; i < counts[c]; i++ {
+			m.Particles.Append(m.newParticle(m.rnd, uint32(c)))
 		}
 	}
+	m.Particles.Group(len(m.Configs))
+}
+
+// Place a new particle of species c according to the init type, trying a few
+// times to keep it out of the walls
+func (m *Model) newParticle(rnd *rand.Rand, c uint32) Particle {
+	const maxTries = 100
+	p := m.placeParticle(rnd, c)
+	for tries := 1; tries < maxTries && m.isWall(p.X, p.Y); tries++ {
+		p = m.placeParticle(rnd, c)
+	}
+	return p
+}
+
+func (m *Model) placeParticle(rnd *rand.Rand, c uint32) Particle {
+	var x, y, a float32
+	switch m.InitType {
+	case Random:
+		x = rnd.Float32() * float32(m.W)
+		y = rnd.Float32() * float32(m.H)
+		a = rnd.Float32() * 2 * math.Pi
+	case Point:
+		x = float32(m.W) / 2
+		y = float32(m.H) / 2
+		a = rnd.Float32() * 2 * math.Pi
+	case RandomCircleRandom:
+		a = rnd.Float32() * 2 * math.Pi
+		circle_radius_fraction := 0.25
+		r := circle_radius_fraction * math.Min(float64(m.H), float64(m.W)) * math.Sqrt(rnd.Float64())
+		x_tmp, y_tmp := math.Sincos(float64(a))
+		x = float32(r*x_tmp) + float32(m.W)/2
+		y = float32(r*y_tmp) + float32(m.H)/2
+		a = rnd.Float32() * 2 * math.Pi
+	case RandomCircleOut:
+		a = rnd.Float32() * 2 * math.Pi
+		circle_radius_fraction := 0.25
+		r := circle_radius_fraction * math.Min(float64(m.H), float64(m.W)) * math.Sqrt(rnd.Float64())
+		y_tmp, x_tmp := math.Sincos(float64(a))
+		x = float32(r*x_tmp) + float32(m.W)/2
+		y = float32(r*y_tmp) + float32(m.H)/2
+	case RandomCircleIn:
+		a = rnd.Float32() * 2 * math.Pi
+		circle_radius_fraction := 0.25
+		r := circle_radius_fraction * math.Min(float64(m.H), float64(m.W)) * math.Sqrt(rnd.Float64())
+		y_tmp, x_tmp := math.Sincos(float64(a))
+		x = float32(r*x_tmp) + float32(m.W)/2
+		y = float32(r*y_tmp) + float32(m.H)/2
+		a_tmp := float64(a + math.Pi)
+		a = float32(math.Atan2(math.Sin(a_tmp), math.Cos(a_tmp)))
+	case RandomCircleCW:
+		a = rnd.Float32() * 2 * math.Pi
+		circle_radius_fraction := 0.25
+		r := circle_radius_fraction * math.Min(float64(m.H), float64(m.W)) * math.Sqrt(rnd.Float64())
+		y_tmp, x_tmp := math.Sincos(float64(a))
+		x = float32(r*x_tmp) + float32(m.W)/2
+		y = float32(r*y_tmp) + float32(m.H)/2
+		a_tmp := float64(a + math.Pi/2.0)
+		a = float32(math.Atan2(math.Sincos(a_tmp)))
+	case RandomCircleQuads:
+		a = rnd.Float32() * 2 * math.Pi
+		circle_radius_fraction := 0.25
+		r := circle_radius_fraction * math.Min(float64(m.H), float64(m.W)) * math.Sqrt(rnd.Float64())
+		x_tmp, y_tmp := math.Sincos(float64(a))
+		x = float32(r*x_tmp) + float32(m.W)/2
+		y = float32(r*y_tmp) + float32(m.H)/2
+	}
+	if false { // for testing, it is a LOT...
+		fmt.Println(x-float32(m.W)/2, y-float32(m.H)/2, a)
+	}
+	return Particle{x, y, a, c}
 }
 
 func (m *Model) Step() {
-	updateParticle := func(rnd *rand.Rand, i int) {
-		p := m.Particles[i]
-		config := m.Configs[p.C]
-		grid := m.Grids[p.C]
-
-		// u := p.X / float32(m.W)
-		// v := p.Y / float32(m.H)
-
-		sensorDistance := config.SensorDistance * m.ZoomFactor
-		sensorAngle := config.SensorAngle
-		rotationAngle := config.RotationAngle
-		stepDistance := config.StepDistance * m.ZoomFactor
-
-		sinResult, cosResult := sincos(p.A)
-		xc := p.X + cosResult*sensorDistance
-		yc := p.Y + sinResult*sensorDistance
-
-		sinResult, cosResult = sincos(p.A - sensorAngle)
-		xl := p.X + cosResult*sensorDistance
-		yl := p.Y + sinResult*sensorDistance
-
-		sinResult, cosResult = sincos(p.A + sensorAngle)
-		xr := p.X + cosResult*sensorDistance
-		yr := p.Y + sinResult*sensorDistance
-
-		C := grid.GetTemp(xc, yc)
-		L := grid.GetTemp(xl, yl)
-		R := grid.GetTemp(xr, yr)
-
-		var da float32
-		if true {
-			da = rotationAngle * direction(rnd, C, L, R)
-		} else {
-			// TODO: what does this do???
-			da = rotationAngle * weightedDirection(rnd, C, L, R)
+	if m.timeline != nil {
+		m.applyTimeline()
+	}
+
+	// Sensors of each species
+	steerings := m.steerings
+	if len(steerings) != len(m.Configs) {
+		log.Fatal("the number of species changed, call UpdateSteerings")
+	}
+	sensors := make([][]Sensor, len(m.Configs))
+	maxSensors := 0
+	populationRules := false
+	for c, config := range m.Configs {
+		sensors[c] = config.SensorLayout()
+		if len(sensors[c]) > maxSensors {
+			maxSensors = len(sensors[c])
+		}
+		populationRules = populationRules || config.hasPopulationRules()
+	}
+	bilinear := isBilinear(m.Interpolation)
+
+	// Move the particles i0 to i1-1, which are all of species c
+	moveSpecies := func(rnd *rand.Rand, particleSource *splitMix64, readings []float32, changes *populationChanges, c, i0, i1 int) {
+		ps := &m.Particles
+		grid := m.Grids[c]
+		layout := sensors[c]
+		steering := steerings[c]
+		readings = readings[:len(layout)]
+		baseStepDistance := m.Configs[c].StepDistance * m.ZoomFactor
+		w, h := float32(m.W), float32(m.H)
+
+		// Parameter maps scale the parameters by where the particle is
+		var scales *parameterScales
+		if c < len(m.parameterScales) {
+			scales = m.parameterScales[c]
+		}
+
+		for i := i0; i < i1; i++ {
+			if particleSource != nil {
+				particleSource.Seed(particleSeed(m.seed, m.Iteration, i))
+			}
+			species := ps.C[i]
+			px, py, pa := ps.X[i], ps.Y[i], ps.Angle(i)
+
+			// u := px / float32(m.W)
+			// v := py / float32(m.H)
+
+			cell := 0
+			if scales != nil {
+				cell = grid.Index(px, py)
+			}
+			stepDistance := baseStepDistance * scales.at(stepDistanceMap, cell)
+			sensorDistanceScale := m.ZoomFactor * scales.at(sensorDistanceMap, cell)
+			sensorAngleScale := scales.at(sensorAngleMap, cell)
+
+			for k, sensor := range layout {
+				sensorDistance := sensor.Distance * sensorDistanceScale
+				sinResult, cosResult := sincos(pa + sensor.Angle*sensorAngleScale)
+				sx, sy := px+cosResult*sensorDistance, py+sinResult*sensorDistance
+				readings[k] = m.sense(c, sx, sy, bilinear)
+			}
+
+			da := layout[steering.Choose(rnd, readings)].Turn * scales.at(rotationAngleMap, cell)
+			pa = Shift(pa+da, 2*math.Pi)
+			sinResult, cosResult := sincos(pa)
+			x := px + cosResult*stepDistance
+			y := py + sinResult*stepDistance
+			if m.flow != nil {
+				vx, vy := m.flow.at(grid.Index(px, py))
+				x += vx
+				y += vy
+			}
+			next := Particle{px, py, pa, species}
+			switch {
+			case x >= 0 && x < w && y >= 0 && y < h:
+				next.X, next.Y = x, y
+			case grid.edge == edgeClamp:
+				next.X, next.Y, next.A = bounce(x, y, pa, w, h)
+			case grid.edge == edgeZero:
+				next = m.newParticle(rnd, species)
+			default:
+				next.X = Shift(x, w)
+				next.Y = Shift(y, h)
+			}
+			if m.isWall(next.X, next.Y) {
+				// Blocked by a wall, stay put and pick a new heading
+				pa = rnd.Float32() * 2 * math.Pi
+			} else if m.Exclusion && !m.moveOccupant(grid.Index(px, py), grid.Index(next.X, next.Y)) {
+				// Blocked by another particle, the same
+				pa = rnd.Float32() * 2 * math.Pi
+			} else {
+				px, py, pa = next.X, next.Y, next.A
+			}
+			ps.X[i], ps.Y[i] = px, py
+			ps.SetAngle(i, pa)
+			if m.ConversionTable != nil {
+				p := Particle{px, py, pa, species}
+				m.convertParticle(rnd, &p)
+				ps.C[i] = p.C
+			}
+
+			if populationRules {
+				m.particleFate(rnd, i, changes)
+			}
 		}
-		p.A = Shift(p.A+da, 2*math.Pi)
-		sinResult, cosResult = sincos(p.A)
-		p.X = Shift(p.X+cosResult*stepDistance, float32(m.W))
-		p.Y = Shift(p.Y+sinResult*stepDistance, float32(m.H))
-		m.Particles[i] = p
 	}
 
 	updateParticles := func(wi, wn int, wg *sync.WaitGroup) {
 		seed := (int64(m.Iteration)<<8 | int64(wi)) + int64(m.seed)
-		rnd := rand.New(rand.NewSource(seed))
-		n := len(m.Particles)
+		var source rand.Source = rand.NewSource(seed)
+		var particleSource *splitMix64
+		if m.Deterministic {
+			particleSource = &splitMix64{}
+			source = particleSource
+		}
+		rnd := rand.New(source)
+		readings := make([]float32, maxSensors)
+		n := m.Particles.Len()
 		batch := int(math.Ceil(float64(n) / float64(wn)))
 		i0 := wi * batch
 		i1 := i0 + batch
 		if wi == wn-1 {
 			i1 = n
 		}
-		for i := i0; i < i1; i++ {
-			updateParticle(rnd, i)
+		// The part of the batch in each species' range
+		for c := range m.Configs {
+			s0, s1 := m.Particles.Species(c)
+			if s0 < i0 {
+				s0 = i0
+			}
+			if s1 > i1 {
+				s1 = i1
+			}
+			if s0 < s1 {
+				moveSpecies(rnd, particleSource, readings, &m.population[wi], c, s0, s1)
+			}
 		}
 		wg.Done()
 	}
 
-	updateGrids := func(c int, wg *sync.WaitGroup) {
+	updateGrids := func(c int) {
 		config := m.Configs[c]
 		grid := m.Grids[c]
-		for _, p := range m.Particles {
-			if uint32(c) == p.C {
-				grid.Add(p.X, p.Y, config.DepositionAmount)
+		for _, f := range m.food {
+			if f.feeds(c) {
+				f.feed(grid.Data, m.Iteration)
 			}
 		}
-		grid.BoxBlur(m.BlurRadius, m.BlurPasses, config.DecayFactor)
-		wg.Done()
-	}
-
-	combineGrids := func(c int, wg *sync.WaitGroup) {
-		grid := m.Grids[c]
-		for i := range grid.Temp {
-			grid.Temp[i] = 0
-		}
-		for i, other := range m.Grids {
-			factor := m.AttractionTable[c][i]
-			for j, value := range other.Data {
-				grid.Temp[j] += value * factor
-			}
+		if m.flow != nil {
+			grid.Advect(m.flow.vx, m.flow.vy)
 		}
-		wg.Done()
+		grid.Diffuse(m.diffusion(c), config.DecayFactor)
 	}
 
 	var wg sync.WaitGroup
 
-	// step 1: combine grids
-	for i := range m.Configs {
-		wg.Add(1)
-		go combineGrids(i, &wg)
+	// The particles were changed from outside since they were last grouped
+	if !m.Particles.grouped(len(m.Configs)) {
+		m.Particles.Group(len(m.Configs))
+	}
+
+	// step 1: combine grids, unless the sensors do it as they go
+	m.attractionTerms()
+	if !m.FusedSensing {
+		m.combineGrids()
 	}
-	wg.Wait()
 
 	// step 2: move particles
-	wn := runtime.NumCPU()
+	workers := m.workers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	wn := workers
+	if m.Exclusion {
+		m.countOccupancy()
+		if m.Deterministic {
+			wn = 1
+		}
+	}
+	if len(m.population) != wn {
+		m.population = make([]populationChanges, wn)
+	}
 	for wi := 0; wi < wn; wi++ {
 		wg.Add(1)
 		go updateParticles(wi, wn, &wg)
 	}
 	wg.Wait()
+	if populationRules {
+		m.applyPopulationChanges(m.population)
+	}
+	if populationRules || m.ConversionTable != nil {
+		m.Particles.Group(len(m.Configs))
+	}
 
-	// step 3: deposit, blur, and decay
-	for i := range m.Configs {
-		wg.Add(1)
-		go updateGrids(i, &wg)
+	// step 3: deposit, and step 4: feed, advect, blur, and decay
+	if isHalf(m.GridPrecision) {
+		// One species at a time in the shared float32 buffers
+		data, temp := m.halfBuffers()
+		m.sortDeposits(workers, bilinear)
+		for c, grid := range m.Grids {
+			grid.expand(data, temp)
+			m.depositSpecies(workers, bilinear, c, c+1)
+			updateGrids(c)
+			grid.compact()
+		}
+	} else {
+		m.deposit(workers, bilinear)
+		for i := range m.Configs {
+			wg.Add(1)
+			go func(c int) {
+				updateGrids(c)
+				wg.Done()
+			}(i)
+		}
+		wg.Wait()
 	}
-	wg.Wait()
 
 	m.Iteration++
 }
 
+func (m *Model) isWall(x, y float32) bool {
+	return m.Obstacles != nil && m.Obstacles[m.Grids[0].Index(x, y)]
+}
+
+// A fresh copy of the grids, see CopySnapshot to take frames without allocating
 func (m *Model) Data() [][]float32 {
 	result := make([][]float32, len(m.Grids))
 	for i, grid := range m.Grids {
-		result[i] = make([]float32, len(grid.Data))
-		copy(result[i], grid.Data)
+		result[i] = make([]float32, grid.W*grid.H)
+		grid.readData(result[i])
 	}
 	return result
 }
-
-func direction(rnd *rand.Rand, C, L, R float32) float32 {
-	if C > L && C > R {
-		return 0
-	} else if C < L && C < R {
-		return float32((rnd.Int63()&1)<<1 - 1)
-	} else if L < R {
-		return 1
-	} else if R < L {
-		return -1
-	}
-	return 0
-}
-
-func weightedDirection(rnd *rand.Rand, C, L, R float32) float32 {
-	W := [3]float32{C, L, R}
-	D := [3]float32{0, -1, 1}
-
-	if W[0] > W[1] {
-		W[0], W[1] = W[1], W[0]
-		D[0], D[1] = D[1], D[0]
-	}
-	if W[0] > W[2] {
-		W[0], W[2] = W[2], W[0]
-		D[0], D[2] = D[2], D[0]
-	}
-	if W[1] > W[2] {
-		W[1], W[2] = W[2], W[1]
-		D[1], D[2] = D[2], D[1]
-	}
-
-	a := W[1] - W[0]
-	b := W[2] - W[1]
-	if rnd.Float32()*(a+b) < a {
-		return D[1]
-	}
-	return D[2]
-}
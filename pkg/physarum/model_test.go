@@ -0,0 +1,181 @@
+package physarum
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func allParticles(m *Model) []Particle {
+	result := make([]Particle, m.Particles.Len())
+	for i := range result {
+		result[i] = m.Particles.At(i)
+	}
+	return result
+}
+
+func TestDeterministicStepIgnoresWorkerCount(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	configs := RandomConfigs(rnd, 2)
+	table := RandomAttractionTable(rnd, 2)
+	run := func(workers int) *Model {
+		m := NewModel(128, 64, 5000, 1, 2, 1, configs, table, RandomCircleIn, Absorbing, nil, 42)
+		m.Deterministic = true
+		m.workers = workers
+		for i := 0; i < 20; i++ {
+			m.Step()
+		}
+		return m
+	}
+
+	a := run(1)
+	b := run(7)
+	for i, p := range allParticles(a) {
+		if b.Particles.At(i) != p {
+			t.Fatalf("particle %d: got %v, want %v", i, b.Particles.At(i), p)
+		}
+	}
+}
+
+func TestStartOverReproducesInitialState(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	m := NewModel(64, 64, 1000, 1, 2, 1, RandomConfigs(rnd, 2), RandomAttractionTable(rnd, 2), RandomCircleRandom, Toroidal, nil, 3)
+	initial := allParticles(m)
+	for i := 0; i < 5; i++ {
+		m.Step()
+	}
+	m.StartOver()
+	for i, p := range initial {
+		if m.Particles.At(i) != p {
+			t.Fatalf("particle %d: got %v, want %v", i, m.Particles.At(i), p)
+		}
+	}
+}
+
+func TestPopulationDynamics(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	configs := RandomConfigs(rnd, 2)
+	configs[0].DivideAbove = 0.1
+	configs[0].DivideChance = 0.5
+	configs[0].MaxParticles = 3000
+	configs[1].DeathBelow = 1e9 // Everything starves
+	table := RandomAttractionTable(rnd, 2)
+	run := func(workers int) *Model {
+		m := NewModel(128, 64, 2000, 1, 2, 1, configs, table, Point, Toroidal, nil, 5)
+		m.Deterministic = true
+		m.MaxParticles = 2500
+		m.workers = workers
+		for i := 0; i < 10; i++ {
+			m.Step()
+		}
+		return m
+	}
+
+	a := run(3)
+	counts := make([]int, 2)
+	for _, c := range a.Particles.C {
+		counts[c]++
+	}
+	if counts[1] != 0 {
+		t.Fatalf("got %d particles of a starving species, want none", counts[1])
+	}
+	if counts[0] <= 1000 || counts[0] > 2500 {
+		t.Fatalf("got %d particles of a dividing species, want more than 1000 up to the cap of 2500", counts[0])
+	}
+
+	b := run(8)
+	if b.Particles.Len() != a.Particles.Len() {
+		t.Fatalf("got %d particles with 8 workers, want %d", b.Particles.Len(), a.Particles.Len())
+	}
+	for i, p := range allParticles(a) {
+		if b.Particles.At(i) != p {
+			t.Fatalf("particle %d: got %v, want %v", i, b.Particles.At(i), p)
+		}
+	}
+}
+
+func TestConvertParticle(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	m := NewModel(32, 32, 10, 1, 2, 1, RandomConfigs(rnd, 3), RandomAttractionTable(rnd, 3), Random, Toroidal, nil, 1)
+	if err := m.SetConversion([][]float32{{0, 1, 1}, {0, 0, 0}, {0, 0, 0}}, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetConversion([][]float32{{0, 1}}, 2); err == nil {
+		t.Fatal("expected an error for a table of the wrong size")
+	}
+
+	i := m.Grids[0].Index(5, 5)
+	m.Grids[0].Temp[i] = 1
+	m.Grids[1].Temp[i] = 1.5 // Not enough over the threshold
+	m.Grids[2].Temp[i] = 3
+	p := Particle{5, 5, 0, 0}
+	m.convertParticle(rnd, &p)
+	if p.C != 2 {
+		t.Fatalf("got species %d, want 2", p.C)
+	}
+
+	p = Particle{5, 5, 0, 1}
+	m.convertParticle(rnd, &p)
+	if p.C != 1 {
+		t.Fatalf("got species %d, want 1 with no chance of converting", p.C)
+	}
+}
+
+func benchmarkStep(b *testing.B, interpolation string) {
+	rnd := rand.New(rand.NewSource(1))
+	m := NewModel(512, 512, 1<<16, 1, 2, 1, RandomConfigs(rnd, 3), RandomAttractionTable(rnd, 3), RandomCircleIn, Toroidal, nil, 1)
+	m.Interpolation = interpolation
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Step()
+	}
+}
+
+func BenchmarkStep(b *testing.B) {
+	benchmarkStep(b, NearestInterpolation)
+}
+
+func BenchmarkStepBilinear(b *testing.B) {
+	benchmarkStep(b, BilinearInterpolation)
+}
+
+func TestExclusion(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	configs := RandomConfigs(rnd, 2)
+	table := RandomAttractionTable(rnd, 2)
+	run := func(workers int, deterministic bool) *Model {
+		m := NewModel(64, 64, 0, 1, 2, 1, configs, table, Random, Toroidal, nil, 1)
+		m.Exclusion = true
+		m.Deterministic = deterministic
+		m.workers = workers
+		angles := rand.New(rand.NewSource(2))
+		// Every other cell, so no two particles start out together
+		for y := 0; y < 64; y += 2 {
+			for x := 0; x < 64; x += 2 {
+				m.Particles.Append(Particle{float32(x) + 0.5, float32(y) + 0.5, angles.Float32() * 7, uint32(x/2) % 2})
+			}
+		}
+		m.Particles.Group(2)
+		for i := 0; i < 20; i++ {
+			m.Step()
+		}
+		return m
+	}
+
+	m := run(8, false)
+	seen := map[int]bool{}
+	for _, p := range allParticles(m) {
+		i := m.Grids[0].Index(p.X, p.Y)
+		if seen[i] {
+			t.Fatalf("two particles in cell %d", i)
+		}
+		seen[i] = true
+	}
+
+	a := run(1, true)
+	b := run(8, true)
+	for i, p := range allParticles(a) {
+		if b.Particles.At(i) != p {
+			t.Fatalf("particle %d: got %v, want %v", i, b.Particles.At(i), p)
+		}
+	}
+}
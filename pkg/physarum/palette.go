@@ -8,17 +8,17 @@ import (
 
 type Palette []color.RGBA
 
-func ShuffledPalette(palette Palette) Palette {
+func ShuffledPalette(rnd *rand.Rand, palette Palette) Palette {
 	result := make(Palette, len(palette))
-	for i, j := range rand.Perm(len(result)) {
+	for i, j := range rnd.Perm(len(result)) {
 		result[i] = palette[j]
 	}
 	return result
 }
 
-func RandomPalette() Palette {
-	palette := Palettes[rand.Intn(len(Palettes))]
-	return ShuffledPalette(palette)
+func RandomPalette(rnd *rand.Rand) Palette {
+	palette := Palettes[rnd.Intn(len(Palettes))]
+	return ShuffledPalette(rnd, palette)
 }
 
 func (p Palette) Print() {
@@ -0,0 +1,136 @@
+package physarum
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The config parameters that can vary across the grid. The others are
+// counts, a policy, or shape the blur of a whole grid, and can not.
+const (
+	MapSensorAngle      = "SensorAngle"
+	MapSensorDistance   = "SensorDistance"
+	MapRotationAngle    = "RotationAngle"
+	MapStepDistance     = "StepDistance"
+	MapDepositionAmount = "DepositionAmount"
+	MapDecayFactor      = "DecayFactor"
+	MapDeathBelow       = "DeathBelow"
+	MapDeathAbove       = "DeathAbove"
+	MapDivideAbove      = "DivideAbove"
+	MapDeathChance      = "DeathChance"
+	MapDivideChance     = "DivideChance"
+)
+
+// All of the parameters that can vary across the grid in a slice
+var AllMapParameters = [...]string{
+	MapSensorAngle,
+	MapSensorDistance,
+	MapRotationAngle,
+	MapStepDistance,
+	MapDepositionAmount,
+	MapDecayFactor,
+	MapDeathBelow,
+	MapDeathAbove,
+	MapDivideAbove,
+	MapDeathChance,
+	MapDivideChance,
+}
+
+// A grayscale image that scales a parameter of a species across the grid.
+// Where the image is black the parameter is multiplied by Min, where it is
+// white by Max, and linearly in between. Both zero means 0 to 1. Several maps
+// of the same parameter multiply together.
+type ParameterMap struct {
+	Parameter string // Which parameter, one of AllMapParameters
+	Image     string // Path to a grayscale PNG, resampled to the grid
+	Min       float32
+	Max       float32
+}
+
+// Indices of the parameters in AllMapParameters
+const (
+	sensorAngleMap = iota
+	sensorDistanceMap
+	rotationAngleMap
+	stepDistanceMap
+	depositionAmountMap
+	decayFactorMap
+	deathBelowMap
+	deathAboveMap
+	divideAboveMap
+	deathChanceMap
+	divideChanceMap
+)
+
+// Per cell multipliers of one species' parameters, nil where a parameter is uniform
+type parameterScales [len(AllMapParameters)][]float32
+
+func mapParameterIndex(parameter string) int {
+	for i, p := range AllMapParameters {
+		if p == parameter {
+			return i
+		}
+	}
+	return -1
+}
+
+// Multiplier of parameter at grid cell i, 1 if the parameter has no map
+func (s *parameterScales) at(parameter, i int) float32 {
+	if s == nil || s[parameter] == nil {
+		return 1
+	}
+	return s[parameter][i]
+}
+
+// Read the images of the configs' parameter maps. NewModel reads them once,
+// it needs to be called again when the maps change.
+func (m *Model) LoadParameterMaps() error {
+	scales := make([]*parameterScales, len(m.Configs))
+	for c, config := range m.Configs {
+		for _, pm := range config.ParameterMaps {
+			parameter := mapParameterIndex(pm.Parameter)
+			if parameter < 0 {
+				return fmt.Errorf("species %d maps unknown parameter %q, it can map %s",
+					c, pm.Parameter, strings.Join(AllMapParameters[:], ", "))
+			}
+			mask, err := LoadMask(pm.Image, m.W, m.H)
+			if err != nil {
+				return err
+			}
+			lo, hi := pm.Min, pm.Max
+			if lo == 0 && hi == 0 {
+				hi = 1
+			}
+			if scales[c] == nil {
+				scales[c] = &parameterScales{}
+			}
+			s := scales[c][parameter]
+			if s == nil {
+				s = make([]float32, len(mask))
+				for i := range s {
+					s[i] = 1
+				}
+				scales[c][parameter] = s
+			}
+			for i, value := range mask {
+				s[i] *= lo + (hi-lo)*value
+			}
+		}
+	}
+	m.parameterScales = scales
+	m.setDecayMaps()
+	return nil
+}
+
+// Hand the per cell decay of each species to its grid, which applies it when blurring
+func (m *Model) setDecayMaps() {
+	for c, grid := range m.Grids {
+		if grid == nil {
+			continue // Not made yet, StartOver hands the maps over when it makes them
+		}
+		grid.DecayMap = nil
+		if c < len(m.parameterScales) && m.parameterScales[c] != nil {
+			grid.DecayMap = m.parameterScales[c][decayFactorMap]
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package physarum
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParameterMaps(t *testing.T) {
+	// Left half black, right half white
+	im := image.NewGray(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 2; x < 4; x++ {
+			im.SetGray(x, y, color.Gray{255})
+		}
+	}
+	path := filepath.Join(t.TempDir(), "map.png")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(file, im); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	rnd := rand.New(rand.NewSource(1))
+	configs := RandomConfigs(rnd, 2)
+	configs[1].ParameterMaps = []ParameterMap{
+		{Parameter: MapDecayFactor, Image: path, Min: 0.5, Max: 1},
+		{Parameter: MapDecayFactor, Image: path},
+	}
+	m := NewModel(8, 8, 10, 1, 0, 1, configs, RandomAttractionTable(rnd, 2), Random, Toroidal, nil, 1)
+	if m.Grids[0].DecayMap != nil {
+		t.Error("species without maps got a decay map")
+	}
+
+	grid := m.Grids[1]
+	for i := range grid.Data {
+		grid.Data[i] = 1
+	}
+	grid.BoxBlur(0, 0, 0.5)
+	if got := grid.Get(1, 1); got != 0 {
+		t.Errorf("black cell: got %v, want 0", got)
+	}
+	if got := grid.Get(6, 1); got != 0.5 {
+		t.Errorf("white cell: got %v, want 0.5", got)
+	}
+
+	for _, parameter := range []string{"Speed", "BlurRadius", "Particles"} {
+		m.Configs[1].ParameterMaps = []ParameterMap{{Parameter: parameter, Image: path}}
+		err := m.LoadParameterMaps()
+		if err == nil {
+			t.Errorf("%s: expected an error for a parameter that can not be mapped", parameter)
+		} else if !strings.Contains(err.Error(), MapDivideChance) {
+			t.Errorf("%s: the error does not list the parameters that can be mapped: %v", parameter, err)
+		}
+	}
+}
+
+func TestPopulationParameterMaps(t *testing.T) {
+	// Left half black, right half white
+	im := image.NewGray(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		im.SetGray(2, y, color.Gray{255})
+		im.SetGray(3, y, color.Gray{255})
+	}
+	path := writeTestImage(t, im)
+
+	rnd := rand.New(rand.NewSource(1))
+	configs := RandomConfigs(rnd, 1)
+	configs[0].DeathBelow = 1e9 // Starving everywhere, but the map turns it off on the left
+	configs[0].ParameterMaps = []ParameterMap{{Parameter: MapDeathBelow, Image: path}}
+	m := NewModel(8, 8, 0, 1, 0, 1, configs, RandomAttractionTable(rnd, 1), Random, Toroidal, nil, 1)
+	m.Particles.Append(Particle{1, 4, 0, 0})
+	m.Particles.Append(Particle{6, 4, 0, 0})
+	var changes populationChanges
+	for i := 0; i < m.Particles.Len(); i++ {
+		m.particleFate(rnd, i, &changes)
+	}
+	if len(changes.dead) != 1 || changes.dead[0] != 1 {
+		t.Fatalf("got dead particles %v, want [1]", changes.dead)
+	}
+
+	// A death chance mapped to zero on the left saves a particle there
+	m.Configs[0].ParameterMaps = []ParameterMap{{Parameter: MapDeathChance, Image: path}}
+	if err := m.LoadParameterMaps(); err != nil {
+		t.Fatal(err)
+	}
+	changes = populationChanges{}
+	for i := 0; i < m.Particles.Len(); i++ {
+		m.particleFate(rnd, i, &changes)
+	}
+	if len(changes.dead) != 1 || changes.dead[0] != 1 {
+		t.Fatalf("mapped chance: got dead particles %v, want [1]", changes.dead)
+	}
+}
@@ -1,8 +1,226 @@
 package physarum
 
+import "math"
+
 type Particle struct {
 	X float32
 	Y float32
 	A float32
 	C uint32
 }
+
+const angleUnit = 2 * math.Pi / 65536 // Radians in one step of a compact angle
+
+// All the particles of a model as a structure of arrays, grouped by species
+// after every step so each species is a contiguous range. The headings are
+// either float32 radians, or uint16 fractions of a turn with compact angles.
+type Particles struct {
+	X   []float32
+	Y   []float32
+	A   []float32 // Headings in radians, nil with compact angles
+	A16 []uint16  // Headings in 1/65536ths of a turn, nil without compact angles
+	C   []uint32
+
+	Starts []int // Where each species starts, and one past the last particle
+
+	scratch *Particles // Reused while grouping
+}
+
+func newParticles(capacity int, compactAngles bool) Particles {
+	ps := Particles{
+		X: make([]float32, 0, capacity),
+		Y: make([]float32, 0, capacity),
+		C: make([]uint32, 0, capacity),
+	}
+	if compactAngles {
+		ps.A16 = make([]uint16, 0, capacity)
+	} else {
+		ps.A = make([]float32, 0, capacity)
+	}
+	return ps
+}
+
+func (ps *Particles) Len() int {
+	return len(ps.X)
+}
+
+func (ps *Particles) CompactAngles() bool {
+	return ps.A16 != nil
+}
+
+func (ps *Particles) Angle(i int) float32 {
+	if ps.A16 != nil {
+		return float32(ps.A16[i]) * angleUnit
+	}
+	return ps.A[i]
+}
+
+func (ps *Particles) SetAngle(i int, a float32) {
+	if ps.A16 != nil {
+		ps.A16[i] = compactAngle(a)
+		return
+	}
+	ps.A[i] = a
+}
+
+// Nearest compact angle, wrapping around at a full turn
+func compactAngle(a float32) uint16 {
+	return uint16(int64(math.Round(float64(a)/angleUnit)) & 0xffff)
+}
+
+func (ps *Particles) At(i int) Particle {
+	return Particle{ps.X[i], ps.Y[i], ps.Angle(i), ps.C[i]}
+}
+
+func (ps *Particles) Set(i int, p Particle) {
+	ps.X[i] = p.X
+	ps.Y[i] = p.Y
+	ps.SetAngle(i, p.A)
+	ps.C[i] = p.C
+}
+
+// Add a particle at the end, Group puts it with its species
+func (ps *Particles) Append(p Particle) {
+	ps.X = append(ps.X, p.X)
+	ps.Y = append(ps.Y, p.Y)
+	if ps.A16 != nil {
+		ps.A16 = append(ps.A16, compactAngle(p.A))
+	} else {
+		ps.A = append(ps.A, p.A)
+	}
+	ps.C = append(ps.C, p.C)
+}
+
+// Keep the first n particles
+func (ps *Particles) Truncate(n int) {
+	ps.X = ps.X[:n]
+	ps.Y = ps.Y[:n]
+	if ps.A16 != nil {
+		ps.A16 = ps.A16[:n]
+	} else {
+		ps.A = ps.A[:n]
+	}
+	ps.C = ps.C[:n]
+}
+
+// Make room for n particles, the ones past the old length are undefined
+func (ps *Particles) resize(n int) {
+	ps.X = resizeFloat32s(ps.X, n)
+	ps.Y = resizeFloat32s(ps.Y, n)
+	if ps.A16 != nil {
+		if n <= cap(ps.A16) {
+			ps.A16 = ps.A16[:n]
+		} else {
+			ps.A16 = append(ps.A16[:cap(ps.A16)], make([]uint16, n-cap(ps.A16))...)
+		}
+	} else {
+		ps.A = resizeFloat32s(ps.A, n)
+	}
+	if n <= cap(ps.C) {
+		ps.C = ps.C[:n]
+	} else {
+		ps.C = append(ps.C[:cap(ps.C)], make([]uint32, n-cap(ps.C))...)
+	}
+}
+
+func resizeFloat32s(s []float32, n int) []float32 {
+	if n <= cap(s) {
+		return s[:n]
+	}
+	return append(s[:cap(s)], make([]float32, n-cap(s))...)
+}
+
+// Copy particle src over particle dst
+func (ps *Particles) move(dst, src int) {
+	ps.X[dst] = ps.X[src]
+	ps.Y[dst] = ps.Y[src]
+	if ps.A16 != nil {
+		ps.A16[dst] = ps.A16[src]
+	} else {
+		ps.A[dst] = ps.A[src]
+	}
+	ps.C[dst] = ps.C[src]
+}
+
+// Range of the particles of species c, valid after Group
+func (ps *Particles) Species(c int) (int, int) {
+	return ps.Starts[c], ps.Starts[c+1]
+}
+
+// Do the species ranges cover the particles, as they do after Group
+func (ps *Particles) grouped(numSpecies int) bool {
+	return len(ps.Starts) == numSpecies+1 && ps.Starts[numSpecies] == ps.Len()
+}
+
+// Sort the particles by species, keeping their order within each species
+func (ps *Particles) Group(numSpecies int) {
+	if len(ps.Starts) != numSpecies+1 {
+		ps.Starts = make([]int, numSpecies+1)
+	}
+	counts := ps.Starts[1:]
+	for c := range counts {
+		counts[c] = 0
+	}
+	sorted := true
+	for i, c := range ps.C {
+		counts[c]++
+		if i > 0 && c < ps.C[i-1] {
+			sorted = false
+		}
+	}
+	for c := 1; c < numSpecies; c++ {
+		counts[c] += counts[c-1]
+	}
+	if sorted {
+		return
+	}
+
+	if ps.scratch == nil {
+		scratch := newParticles(ps.Len(), ps.CompactAngles())
+		ps.scratch = &scratch
+	}
+	s := ps.scratch
+	s.resize(ps.Len())
+	next := append([]int(nil), ps.Starts[:numSpecies]...)
+	for i, c := range ps.C {
+		j := next[c]
+		next[c]++
+		s.X[j] = ps.X[i]
+		s.Y[j] = ps.Y[i]
+		if ps.A16 != nil {
+			s.A16[j] = ps.A16[i]
+		} else {
+			s.A[j] = ps.A[i]
+		}
+		s.C[j] = c
+	}
+	ps.X, s.X = s.X, ps.X
+	ps.Y, s.Y = s.Y, ps.Y
+	ps.A, s.A = s.A, ps.A
+	ps.A16, s.A16 = s.A16, ps.A16
+	ps.C, s.C = s.C, ps.C
+}
+
+// Switch between float32 and compact uint16 headings. Compact headings save
+// two bytes per particle, and are rounded to 1/65536th of a turn.
+func (m *Model) SetCompactAngles(compact bool) {
+	ps := &m.Particles
+	if ps.CompactAngles() == compact {
+		return
+	}
+	n := ps.Len()
+	if compact {
+		ps.A16 = make([]uint16, n, cap(ps.X))
+		for i, a := range ps.A {
+			ps.A16[i] = compactAngle(a)
+		}
+		ps.A = nil
+	} else {
+		ps.A = make([]float32, n, cap(ps.X))
+		for i, a := range ps.A16 {
+			ps.A[i] = float32(a) * angleUnit
+		}
+		ps.A16 = nil
+	}
+	ps.scratch = nil
+}
@@ -0,0 +1,81 @@
+package physarum
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestParticlesGroup(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		ps := newParticles(0, compact)
+		for i, c := range []uint32{2, 0, 1, 0, 2, 1, 0} {
+			ps.Append(Particle{float32(i), 0, 1, c})
+		}
+		ps.Group(4)
+		want := []float32{1, 3, 6, 2, 5, 0, 4}
+		for i, x := range want {
+			if ps.X[i] != x {
+				t.Fatalf("compact %v: got order %v, want %v", compact, ps.X, want)
+			}
+		}
+		for c, want := range [][2]int{{0, 3}, {3, 5}, {5, 7}, {7, 7}} {
+			if start, end := ps.Species(c); start != want[0] || end != want[1] {
+				t.Errorf("compact %v: species %d is %d to %d, want %d to %d", compact, c, start, end, want[0], want[1])
+			}
+		}
+		if got := ps.Angle(6); math.Abs(float64(got-1)) > angleUnit {
+			t.Errorf("compact %v: got angle %v, want 1", compact, got)
+		}
+	}
+}
+
+func TestStepGroupsParticles(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	m := NewModel(32, 32, 0, 1, 2, 1, RandomConfigs(rnd, 3), RandomAttractionTable(rnd, 3), Random, Toroidal, nil, 1)
+	for i := 0; i < 30; i++ {
+		m.Particles.Append(Particle{rnd.Float32() * 32, rnd.Float32() * 32, 0, uint32(2 - i%3)})
+	}
+	m.Step()
+	for c := 0; c < 3; c++ {
+		start, end := m.Particles.Species(c)
+		if start != c*10 || end != c*10+10 {
+			t.Fatalf("species %d is %d to %d, want %d to %d", c, start, end, c*10, c*10+10)
+		}
+		for i := start; i < end; i++ {
+			if m.Particles.C[i] != uint32(c) {
+				t.Fatalf("particle %d of species %d in the range of species %d", i, m.Particles.C[i], c)
+			}
+		}
+	}
+}
+
+func TestCompactAngles(t *testing.T) {
+	if a := compactAngle(-0.1); a != compactAngle(2*math.Pi-0.1) {
+		t.Errorf("negative angles do not wrap around: %v", a)
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	configs := RandomConfigs(rnd, 2)
+	table := RandomAttractionTable(rnd, 2)
+	run := func(workers int) *Model {
+		m := NewModel(128, 64, 5000, 1, 2, 1, configs, table, RandomCircleIn, Toroidal, nil, 42)
+		m.SetCompactAngles(true)
+		m.Deterministic = true
+		m.workers = workers
+		for i := 0; i < 10; i++ {
+			m.Step()
+		}
+		return m
+	}
+	a := run(1)
+	b := run(5)
+	if a.Particles.A != nil || len(a.Particles.A16) != a.Particles.Len() {
+		t.Fatal("headings are not compact")
+	}
+	for i, p := range allParticles(a) {
+		if b.Particles.At(i) != p {
+			t.Fatalf("particle %d: got %v, want %v", i, b.Particles.At(i), p)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package physarum
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// A fixed set of goroutines shared by everything that splits its work up,
+// instead of starting new goroutines for every row of every pass
+type workerPool struct {
+	tasks chan func()
+	idle  int32 // Workers not running a task, claimed before a task is queued
+}
+
+func newWorkerPool(size int) *workerPool {
+	p := &workerPool{tasks: make(chan func(), size), idle: int32(size)}
+	for i := 0; i < size; i++ {
+		go func() {
+			for task := range p.tasks {
+				task()
+				atomic.AddInt32(&p.idle, 1)
+			}
+		}()
+	}
+	return p
+}
+
+// Queue the task if a worker is free to pick it up right away, so a queued
+// task never waits behind workers that are themselves waiting
+func (p *workerPool) tryGo(task func()) bool {
+	for {
+		idle := atomic.LoadInt32(&p.idle)
+		if idle <= 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&p.idle, idle, idle-1) {
+			p.tasks <- task
+			return true
+		}
+	}
+}
+
+var sharedPool = newWorkerPool(runtime.NumCPU())
+
+// Run f(0) to f(n-1) on the calling goroutine and at most workers-1 goroutines
+// of the shared pool, returning when all are done. Helpers are only handed to
+// idle workers, and the caller works through the items itself, so calls from
+// several goroutines at once, or from inside f, never wait on a task that no
+// worker is free to run.
+func parallelFor(n, workers int, f func(i int)) {
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			f(i)
+		}
+		return
+	}
+
+	var next int64 = -1
+	work := func() {
+		for {
+			i := int(atomic.AddInt64(&next, 1))
+			if i >= n {
+				return
+			}
+			f(i)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for w := 1; w < workers; w++ {
+		wg.Add(1)
+		if !sharedPool.tryGo(func() { defer wg.Done(); work() }) {
+			wg.Done() // The pool is busy, make do with fewer helpers
+			break
+		}
+	}
+	work()
+	wg.Wait()
+}
+
+// Run f on tiles of rows of a grid h rows high, f gets the first and one past the last row
+func parallelRows(h int, f func(y0, y1 int)) {
+	tiles := (h + tileRows - 1) / tileRows
+	parallelFor(tiles, runtime.NumCPU(), func(t int) {
+		y0 := t * tileRows
+		y1 := y0 + tileRows
+		if y1 > h {
+			y1 = h
+		}
+		f(y0, y1)
+	})
+}
+
+const (
+	tileRows = 16 // Rows in a tile of work
+	tileSize = 32 // Width and height of the blocks of a transpose
+)
+
+// Write the w x h src into the h x w dst with rows and columns swapped, a
+// block at a time so both sides stay in cache
+func transpose(src, dst []float32, w, h int) {
+	parallelRows(h, func(y0, y1 int) {
+		for bx := 0; bx < w; bx += tileSize {
+			x1 := bx + tileSize
+			if x1 > w {
+				x1 = w
+			}
+			for y := y0; y < y1; y++ {
+				for x := bx; x < x1; x++ {
+					dst[x*h+y] = src[y*w+x]
+				}
+			}
+		}
+	})
+}
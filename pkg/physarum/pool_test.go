@@ -0,0 +1,33 @@
+package physarum
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNestedParallelFor(t *testing.T) {
+	saved := sharedPool
+	sharedPool = newWorkerPool(2)
+	defer func() { sharedPool = saved }()
+
+	var count int64
+	done := make(chan bool)
+	go func() {
+		parallelFor(16, 8, func(i int) {
+			parallelFor(16, 8, func(j int) {
+				time.Sleep(time.Millisecond)
+				atomic.AddInt64(&count, 1)
+			})
+		})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("nested calls did not finish")
+	}
+	if count != 16*16 {
+		t.Fatalf("got %d calls, want %d", count, 16*16)
+	}
+}
@@ -0,0 +1,99 @@
+package physarum
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Births and deaths found by one particle worker during a step
+type populationChanges struct {
+	dead []int // Indices of the particles that died, in increasing order
+	born []Particle
+}
+
+// Does this species have any birth or death rules
+func (c Config) hasPopulationRules() bool {
+	return c.DeathBelow > 0 || c.DeathAbove > 0 || c.DivideAbove > 0
+}
+
+// Decide if particle i dies or divides, based on the trail of its own species where it is
+func (m *Model) particleFate(rnd *rand.Rand, i int, changes *populationChanges) {
+	p := m.Particles.At(i)
+	config := &m.Configs[p.C]
+	grid := m.Grids[p.C]
+
+	// Parameter maps scale the thresholds and chances by where the particle is
+	var scales *parameterScales
+	cell := 0
+	if int(p.C) < len(m.parameterScales) && m.parameterScales[p.C] != nil {
+		scales = m.parameterScales[p.C]
+		cell = grid.Index(p.X, p.Y)
+	}
+	chance := func(probability float32, parameter int) bool {
+		if probability <= 0 {
+			probability = 1
+		}
+		probability *= scales.at(parameter, cell)
+		return probability >= 1 || rnd.Float32() < probability
+	}
+
+	trail := grid.Get(p.X, p.Y)
+	starving := config.DeathBelow > 0 && trail < config.DeathBelow*scales.at(deathBelowMap, cell)
+	crowded := config.DeathAbove > 0 && trail > config.DeathAbove*scales.at(deathAboveMap, cell)
+	if starving || crowded {
+		if chance(config.DeathChance, deathChanceMap) {
+			changes.dead = append(changes.dead, i)
+		}
+		return
+	}
+	if config.DivideAbove > 0 && trail > config.DivideAbove*scales.at(divideAboveMap, cell) && chance(config.DivideChance, divideChanceMap) {
+		child := p
+		child.A = rnd.Float32() * 2 * math.Pi
+		changes.born = append(changes.born, child)
+	}
+}
+
+// Remove the particles that died and add the ones that were born, as long as
+// the caps allow, in particle order so the result does not depend on the workers
+func (m *Model) applyPopulationChanges(changes []populationChanges) {
+	ps := &m.Particles
+	keep := 0
+	next := 0
+	survive := func(end int) {
+		for ; next < end; next++ {
+			ps.move(keep, next)
+			keep++
+		}
+	}
+	for _, c := range changes {
+		for _, i := range c.dead {
+			survive(i)
+			next = i + 1
+		}
+	}
+	survive(ps.Len())
+	ps.Truncate(keep)
+
+	counts := make([]int, len(m.Configs))
+	for _, c := range ps.C {
+		counts[c]++
+	}
+	for _, c := range changes {
+		for _, child := range c.born {
+			if m.MaxParticles > 0 && ps.Len() >= m.MaxParticles {
+				break
+			}
+			limit := m.Configs[child.C].MaxParticles
+			if limit > 0 && counts[child.C] >= limit {
+				continue
+			}
+			ps.Append(child)
+			counts[child.C]++
+		}
+	}
+
+	for i := range changes {
+		changes[i].dead = changes[i].dead[:0]
+		changes[i].born = changes[i].born[:0]
+	}
+}
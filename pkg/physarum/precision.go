@@ -0,0 +1,171 @@
+package physarum
+
+import (
+	"log"
+	"math"
+)
+
+// All the supported ways of storing the trail grids
+const (
+	Float32Grids = "float32" // Full precision, fastest
+	Float16Grids = "float16" // Half the memory, values are rounded to 11 significant bits and saturate at 65504
+)
+
+// All of the supported grid precisions in a slice
+var AllGridPrecisions = [...]string{
+	Float32Grids,
+	Float16Grids,
+}
+
+// Does the precision store grids in half floats, log.Fatal if it is unknown
+func isHalf(precision string) bool {
+	switch precision {
+	case Float32Grids, "":
+		return false
+	case Float16Grids:
+		return true
+	}
+	log.Fatalf("unknown grid precision %q", precision)
+	return false
+}
+
+const maxHalf = 0x7bff // Largest finite half float, 65504
+
+// Nearest half float to f, rounding ties to even. Values too large for a half
+// float saturate instead of becoming infinite, so one hot cell can not turn
+// into an infinity that the blur spreads over its neighbors.
+func toHalf(f float32) uint16 {
+	b := math.Float32bits(f)
+	sign := uint16(b>>16) & 0x8000
+	exp := int(b>>23&0xff) - 127 + 15
+	mant := b & 0x7fffff
+	switch {
+	case b&0x7fffffff == 0:
+		return sign
+	case b&0x7f800000 == 0x7f800000 && mant != 0:
+		return sign | 0x7e00 // NaN
+	case exp >= 31:
+		return sign | maxHalf
+	case exp <= 0:
+		// Subnormal, or too small and rounds to zero
+		if exp < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint(14 - exp)
+		half := mant >> shift
+		rem := mant & (1<<shift - 1)
+		halfway := uint32(1) << (shift - 1)
+		if rem > halfway || rem == halfway && half&1 == 1 {
+			half++
+		}
+		return sign | uint16(half)
+	}
+	half := uint32(exp)<<10 | mant>>13
+	rem := mant & 0x1fff
+	if rem > 0x1000 || rem == 0x1000 && half&1 == 1 {
+		half++ // A carry out of the mantissa bumps the exponent, as it should
+	}
+	if half > maxHalf {
+		half = maxHalf
+	}
+	return sign | uint16(half)
+}
+
+func fromHalf(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+	switch exp {
+	case 0:
+		f := float32(mant) / (1 << 24)
+		if sign != 0 {
+			return -f
+		}
+		return f
+	case 31:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	}
+	return math.Float32frombits(sign | (exp-15+127)<<23 | mant<<13)
+}
+
+// Every half float as a float32, looking them up is faster than converting
+var halfTable = func() (table [1 << 16]float32) {
+	for h := range table {
+		table[h] = fromHalf(uint16(h))
+	}
+	return
+}()
+
+// Trail of cell i, whichever way the grid is stored
+func (g *Grid) dataAt(i int) float32 {
+	if g.Data != nil {
+		return g.Data[i]
+	}
+	return halfTable[g.data16[i]]
+}
+
+func (g *Grid) setData(i int, value float32) {
+	if g.Data != nil {
+		g.Data[i] = value
+		return
+	}
+	g.data16[i] = toHalf(value)
+}
+
+// Combined field of cell i, whichever way the grid is stored
+func (g *Grid) tempAt(i int) float32 {
+	if g.Temp != nil {
+		return g.Temp[i]
+	}
+	return halfTable[g.temp16[i]]
+}
+
+// Copy the trail into dst as float32s
+func (g *Grid) readData(dst []float32) {
+	if g.Data != nil {
+		copy(dst, g.Data)
+		return
+	}
+	parallelRows(g.H, func(y0, y1 int) {
+		for i := y0 * g.W; i < y1*g.W; i++ {
+			dst[i] = halfTable[g.data16[i]]
+		}
+	})
+}
+
+// Unpack a half float grid into the float32 buffers data and temp, so that
+// the blur and everything else that works on whole grids can run on it as
+// usual. Does nothing for a float32 grid.
+func (g *Grid) expand(data, temp []float32) {
+	if g.data16 == nil {
+		return
+	}
+	g.readData(data)
+	g.Data = data
+	g.Temp = temp
+}
+
+// Pack an expanded grid back into half floats, and let go of the float32 buffers
+func (g *Grid) compact() {
+	if g.data16 == nil || g.Data == nil {
+		return
+	}
+	parallelRows(g.H, func(y0, y1 int) {
+		for i := y0 * g.W; i < y1*g.W; i++ {
+			g.data16[i] = toHalf(g.Data[i])
+		}
+	})
+	g.Data = nil
+	g.Temp = nil
+}
+
+// Float32 buffers shared by all half float grids, one species is expanded
+// into them at a time
+func (m *Model) halfBuffers() ([]float32, []float32) {
+	if len(m.work[0]) != m.W*m.H {
+		m.work[0] = make([]float32, m.W*m.H)
+		m.work[1] = make([]float32, m.W*m.H)
+	}
+	return m.work[0], m.work[1]
+}
@@ -0,0 +1,65 @@
+package physarum
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestHalf(t *testing.T) {
+	cases := []struct {
+		f    float32
+		want float32
+	}{
+		{0, 0},
+		{1, 1},
+		{-2.5, -2.5},
+		{65504, 65504},
+		{1e6, 65504},                       // Saturates
+		{float32(math.Inf(1)), 65504},      // Saturates
+		{1 + 1.0/2048, 1},                  // Tie, rounds to even
+		{1 + 3.0/2048, 1 + 2.0/1024},       // Tie, rounds to even
+		{1.0 / (1 << 24), 1.0 / (1 << 24)}, // Smallest subnormal
+		{1.0 / (1 << 26), 0},
+	}
+	for _, c := range cases {
+		if got := fromHalf(toHalf(c.f)); got != c.want {
+			t.Errorf("%g: got %g, want %g", c.f, got, c.want)
+		}
+	}
+	for h := 0; h < 0x7c00; h++ {
+		if got := toHalf(fromHalf(uint16(h))); got != uint16(h) {
+			t.Fatalf("%#04x: got %#04x", h, got)
+		}
+	}
+}
+
+func TestFloat16Grids(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	configs := RandomConfigs(rnd, 2)
+	table := RandomAttractionTable(rnd, 2)
+	run := func(precision string) *Model {
+		m := newModel(64, 64, 2000, 1, 2, 1, configs, table, Random, Toroidal, nil, 5)
+		m.GridPrecision = precision
+		m.Deterministic = true
+		m.StartOver()
+		m.Step() // The combined fields start out empty, so the particles move the same
+		return m
+	}
+
+	full := run(Float32Grids)
+	half := run(Float16Grids)
+	for c, grid := range half.Grids {
+		if grid.Data != nil || grid.Temp != nil {
+			t.Fatalf("grid %d kept its float32 buffers", c)
+		}
+	}
+	want := full.Data()
+	for c, data := range half.Data() {
+		for i, value := range data {
+			if math.Abs(float64(value-want[c][i])) > 1e-3*math.Abs(float64(want[c][i]))+1e-6 {
+				t.Fatalf("grid %d cell %d: got %g, want %g", c, i, value, want[c][i])
+			}
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package physarum
+
+// SplitMix64 random source, tiny and cheap to re-seed, so that every particle
+// can have its own stream of random numbers in deterministic mode
+type splitMix64 struct {
+	state uint64
+}
+
+func (s *splitMix64) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+func (s *splitMix64) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	return mix64(s.state)
+}
+
+func (s *splitMix64) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+func mix64(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Seed for the random numbers used by particle i during an iteration, it does
+// not depend on how the particles are split between the workers
+func particleSeed(seed int64, iteration, i int) int64 {
+	return int64(mix64(mix64(uint64(seed)^mix64(uint64(iteration))) + uint64(i)))
+}
@@ -28,77 +28,80 @@ const (
 	zoomFactor = 1
 )
 
-func one(model *Model, iterations int) {
+func one(rnd *rand.Rand, model *Model, iterations int) {
 	now := time.Now().UTC().UnixNano() / 1000
 	file := fmt.Sprintf("out%d.png", now)
 	fmt.Println()
 	fmt.Println(file)
-	fmt.Println(len(model.Particles), "particles")
+	fmt.Println(model.Particles.Len(), "particles")
 	PrintConfigs(model.Configs, model.AttractionTable)
 	SummarizeConfigs(model.Configs)
 	for i := 0; i < iterations; i++ {
 		model.Step()
 	}
-	palette := RandomPalette()
-	im := Image(model.W, model.H, model.Data(), palette, 0, 0, 1/2.2)
+	palette := RandomPalette(rnd)
+	im := Image(model.W, model.H, model.CopySnapshot().Data, palette, 0, 0, 1/2.2)
 	SavePNG(".", file, im, png.DefaultCompression)
 }
 
-func frames(model *Model, rate int) {
-	palette := RandomPalette()
+func frames(rnd *rand.Rand, model *Model, rate int) {
+	palette := RandomPalette(rnd)
 
-	saveImage := func(path string, file string, w, h int, grids [][]float32) { //, ch chan bool) {
+	saveImage := func(path string, file string, w, h int, grids [][]float32, ch chan bool) {
 		max := particles / float32(width*height) * 20
 		im := Image(w, h, grids, palette, 0, max, 1/2.2)
 		SavePNG(path, file, im, png.BestSpeed)
-		// if ch != nil {
-		// 	ch <- true
-		// }
+		ch <- true
 	}
 
 	now := time.Now().UTC().UnixNano() / 1000
 	path := filepath.Join(".", "output", fmt.Sprintf("%d", now))
 
-	fmt.Println(len(model.Particles), "particles")
+	fmt.Println(model.Particles.Len(), "particles")
 	PrintConfigs(model.Configs, model.AttractionTable)
 	SummarizeConfigs(model.Configs)
 
-	// ch := make(chan bool, 1)
-	// ch <- true
+	// One frame is saved at a time. The snapshot of the next one goes in the
+	// other buffer, so it can be taken before waiting for the last save.
+	ch := make(chan bool, 1)
+	ch <- true
 	for i := 0; ; i++ {
 		if i%1000 == 0 {
 			fmt.Println(i)
 		}
 		model.Step()
 		if i%rate == 0 {
-			// <-ch
+			snapshot := model.CopySnapshot()
+			<-ch
 			file := fmt.Sprintf("frame%08d.png", i/rate)
 			// fmt.Println(path + " " + file)
-			go saveImage(path, file, model.W, model.H, model.Data()) //, ch)
+			go saveImage(path, file, model.W, model.H, snapshot.Data, ch)
 		}
 	}
 }
 
 func Run() {
+	rnd := rand.New(rand.NewSource(time.Now().UTC().UnixNano()))
+
 	if true {
-		n := 2 + rand.Intn(4)
-		configs := RandomConfigs(n)
-		table := RandomAttractionTable(n)
+		n := 2 + rnd.Intn(4)
+		configs := RandomConfigs(rnd, n)
+		table := RandomAttractionTable(rnd, n)
 		model := NewModel(
 			width, height, particles, blurRadius, blurPasses, zoomFactor,
-			configs, table, "random_circle_in", time.Now().UTC().UnixNano()/1000)
-		frames(model, 3)
+			configs, table, "random_circle_in", Toroidal, nil, time.Now().UTC().UnixNano()/1000)
+		frames(rnd, model, 3)
 	}
 
 	for {
-		n := 2 + rand.Intn(4)
-		configs := RandomConfigs(n)
-		table := RandomAttractionTable(n)
+		n := 2 + rnd.Intn(4)
+		configs := RandomConfigs(rnd, n)
+		table := RandomAttractionTable(rnd, n)
 		model := NewModel(
 			width, height, particles, blurRadius, blurPasses, zoomFactor,
-			configs, table, "random", time.Now().UTC().UnixNano()/1000)
+			configs, table, "random", Toroidal, nil, time.Now().UTC().UnixNano()/1000)
 		start := time.Now()
-		one(model, iterations)
+		one(rnd, model, iterations)
 		fmt.Println(time.Since(start))
 	}
 }
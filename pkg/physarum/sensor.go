@@ -0,0 +1,42 @@
+package physarum
+
+// A point a particle samples the trail at, relative to its position and heading
+type Sensor struct {
+	Angle    float32 // Offset from the heading, in radians
+	Distance float32 // Distance from the particle, scaled by the zoom factor
+	Turn     float32 // Rotation when steering picks this sensor, RotationAngle towards the sensor's side if zero
+}
+
+// The sensors of a species with all defaults filled in, the classic center,
+// left and right sensors unless the config lists its own
+func (c Config) SensorLayout() []Sensor {
+	sensors := c.Sensors
+	if len(sensors) == 0 {
+		// Left turns by -RotationAngle and right by RotationAngle, whatever
+		// the signs of the angles
+		sensors = []Sensor{
+			{0, c.SensorDistance, 0},
+			{-c.SensorAngle, c.SensorDistance, -c.RotationAngle},
+			{c.SensorAngle, c.SensorDistance, c.RotationAngle},
+		}
+	}
+
+	layout := make([]Sensor, len(sensors))
+	for i, s := range sensors {
+		if s.Turn == 0 {
+			s.Turn = c.RotationAngle * sign(s.Angle)
+		}
+		layout[i] = s
+	}
+	return layout
+}
+
+func sign(x float32) float32 {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
@@ -17,26 +17,47 @@ type Settings struct {
 	outputPath string
 
 	// Exported below this line
-	Width         int     // Width of the simulation grid
-	Height        int     // Height of the simulation grid
+	Width         int     // Width of the simulation grid, any positive size (powers of two are slightly faster)
+	Height        int     // Height of the simulation grid, any positive size (powers of two are slightly faster)
 	Particles     int     // Number of particles to simulate
+	CompactAngles bool    // Store particle headings in 16 bits instead of 32 to save memory
+	MaxParticles  int     // Cap on the number of particles when species can divide, no cap if zero
 	StepsPerFrame int     // How many
 	Seed          int64   // Seed to use for the random number generator
+	Deterministic bool    // Reproduce the exact same frames from a seed on any machine
+	Exclusion     bool    // At most one particle per cell as in the Jones model, slow with Deterministic
 	NumConfigs    int     // Number of configs, this many random configs will be generated if needed
 	BlurRadius    int     // Radius to use for the blur algorithm
 	BlurPasses    int     // Number of passes to use of the blur algorithm
+	BlurKernel    string  // How trail spreads out: "box", "gaussian", "laplacian" or "anisotropic"
+	BlurSigma     float32 // Standard deviation of the gaussian kernel, BlurRadius if zero
+	DiffusionRate float32 // Diffusion coefficient of the laplacian kernel, 0.2 if zero, at most 0.25
+	BlurRadiusX   int     // Horizontal radius of the anisotropic kernel, BlurRadius if zero
+	BlurRadiusY   int     // Vertical radius of the anisotropic kernel, BlurRadius if zero
+	Interpolation string  // How sensors read and particles deposit: "nearest" or "bilinear" (smoother, slower)
+	GridPrecision string  // How trail is stored: "float32" or "float16" (half the memory, slower)
+	FusedSensing  bool    // Sensors sum the species' trails where they read, faster with far fewer particles than cells
 	ZoomFactor    float32 // Display param
 	Scale         float32 // Display param
 	Gamma         float32 // Palette param
 	InitType      string  // Which init to use
+	Boundary      string  // What happens at the edges of the grid: "toroidal", "reflective" or "absorbing"
+	ObstacleMask  string  // Path to a PNG where dark pixels are walls, optional
 	SaveVideo     bool    // Save video to mp4 file
 	Fps           int     // FPS of the video to be saved
 	MaxSteps      int     // Maximum number of steps to simulate before finishing
 	Crf           int     // Constant Rate Factor for video encoding
 
-	AttractionTable [][]float32 // Defines interactions between the species
-	Configs         []Config    // Define behavior of each species
-	Palette         Palette     // How to make them colorful
+	AttractionTable [][]float32  // Defines interactions between the species
+	Configs         []Config     // Define behavior of each species
+	Food            []FoodSource // Sources of attractant added to the grids every step
+	Flow            Flow         // Vector field that pushes particles and trails, optional
+	Palette         Palette      // How to make them colorful
+
+	ConversionTable     [][]float32 // Chances of particles switching species, optional
+	ConversionThreshold float32     // How far another species' field must exceed a particle's own before it can switch, 1 if zero
+
+	Timeline []Keyframe // Parameter changes over the iterations, optional
 }
 
 func nsSincePsuedoEpoch() int64 {
@@ -59,7 +80,11 @@ func NewSettings(inputSettingsFile string) *Settings {
 		Seed:          nsSincePsuedoEpoch(),
 		BlurRadius:    1,
 		BlurPasses:    2,
+		BlurKernel:    BoxKernel,
+		Interpolation: NearestInterpolation,
+		GridPrecision: Float32Grids,
 		ZoomFactor:    1,
+		Boundary:      Toroidal,
 		Scale:         0.5,
 		Gamma:         1 / 2.2,
 		outputPath:    "output",
@@ -76,35 +101,35 @@ func NewSettings(inputSettingsFile string) *Settings {
 		}
 	}
 
-	// Set the seed according to the settings for deterministic configuration generation
-	rand.Seed(s.Seed)
+	// Random source seeded according to the settings for deterministic configuration generation
+	rnd := rand.New(rand.NewSource(s.Seed))
 
 	// seconds since psuedo-epoch
 	s.outputFile = GetSettingFileRandString()
 
 	// If Pallette is not specified, random palette
 	if s.Palette == nil {
-		s.Palette = RandomPalette()
+		s.Palette = RandomPalette(rnd)
 	}
 
 	// If NumConfigs is not specified, random value (note, this is not used unless the fields below are nil)
 	if s.NumConfigs == 0 {
-		s.NumConfigs = 1 + rand.Intn(5)
+		s.NumConfigs = 1 + rnd.Intn(5)
 	}
 
 	// If Configs is not specified, random config
 	if s.Configs == nil {
-		s.Configs = RandomConfigs(s.NumConfigs)
+		s.Configs = RandomConfigs(rnd, s.NumConfigs)
 	}
 
 	// If AttractionTable is not specified, random attraction table
 	if s.AttractionTable == nil {
-		s.AttractionTable = RandomAttractionTable(s.NumConfigs)
+		s.AttractionTable = RandomAttractionTable(rnd, s.NumConfigs)
 	}
 
 	// If InitType is not specified, random init type
 	if s.InitType == "" {
-		s.InitType = RandomInitType()
+		s.InitType = RandomInitType(rnd)
 	}
 
 	return s
@@ -0,0 +1,30 @@
+package physarum
+
+// A copy of the grids at the end of a step, for rendering or saving while
+// the model carries on stepping
+type Snapshot struct {
+	Iteration int
+	Data      [][]float32
+}
+
+// Copy the grids into one of two buffers that are reused from call to call,
+// so frames can be taken without allocating. It still copies every cell of
+// every grid each call, it only saves the allocations. The snapshot stays
+// valid until the second call after this one, so a renderer can read it while
+// the next steps run, as long as it is done before the one after that is
+// taken. Call it between steps, not while Step runs.
+func (m *Model) CopySnapshot() *Snapshot {
+	s := &m.snapshots[m.nextSnapshot]
+	m.nextSnapshot = 1 - m.nextSnapshot
+	if len(s.Data) != len(m.Grids) {
+		s.Data = make([][]float32, len(m.Grids))
+	}
+	for i, grid := range m.Grids {
+		if len(s.Data[i]) != grid.W*grid.H {
+			s.Data[i] = make([]float32, grid.W*grid.H)
+		}
+		grid.readData(s.Data[i])
+	}
+	s.Iteration = m.Iteration
+	return s
+}
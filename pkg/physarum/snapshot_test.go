@@ -0,0 +1,33 @@
+package physarum
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	m := NewModel(64, 32, 1000, 1, 2, 1, RandomConfigs(rnd, 2), RandomAttractionTable(rnd, 2), Random, Toroidal, nil, 1)
+	m.Step()
+	a := m.CopySnapshot()
+	want := m.Data()
+	m.Step()
+	b := m.CopySnapshot()
+	if a == b || &a.Data[0][0] == &b.Data[0][0] {
+		t.Fatal("consecutive snapshots share a buffer")
+	}
+	if a.Iteration != 1 || b.Iteration != 2 {
+		t.Fatalf("got iterations %d and %d, want 1 and 2", a.Iteration, b.Iteration)
+	}
+	for c := range want {
+		for i, value := range want[c] {
+			if a.Data[c][i] != value {
+				t.Fatalf("grid %d cell %d: got %g, want %g", c, i, a.Data[c][i], value)
+			}
+		}
+	}
+
+	if allocs := testing.AllocsPerRun(10, func() { m.CopySnapshot() }); allocs != 0 {
+		t.Fatalf("got %g allocations per snapshot, want 0", allocs)
+	}
+}
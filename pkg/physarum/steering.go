@@ -0,0 +1,184 @@
+package physarum
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// All the built in steering policies
+const (
+	ClassicSteering  = "classic"  // Keep going if ahead is strongest, turn randomly if it is weakest, otherwise turn to the stronger side (max with other than three sensors)
+	MaxSteering      = "max"      // Always turn towards the strongest sensor
+	WeightedSteering = "weighted" // Randomly turn towards one of the two strongest sensors, weighted by how much they stand out
+	SoftmaxSteering  = "softmax"  // Randomly turn towards any sensor, with softmax probabilities at the config's temperature
+)
+
+// A Steering policy decides which sensor a particle turns towards
+type Steering interface {
+	// Index of the chosen sensor, readings are in the order of the species' sensor layout,
+	// which is center, left and right unless the config lists its own sensors
+	Choose(rnd *rand.Rand, readings []float32) int
+}
+
+// Makes the steering policy for a species
+type SteeringFactory func(config Config) Steering
+
+var (
+	steeringFactoriesLock sync.RWMutex
+	steeringFactories     = map[string]SteeringFactory{
+		ClassicSteering:  func(Config) Steering { return classicSteering{} },
+		MaxSteering:      func(Config) Steering { return maxSteering{} },
+		WeightedSteering: func(Config) Steering { return weightedSteering{} },
+		SoftmaxSteering: func(config Config) Steering {
+			temperature := config.SteeringTemperature
+			if temperature <= 0 {
+				temperature = 1
+			}
+			return softmaxSteering{temperature}
+		},
+	}
+)
+
+// Make a steering policy available to configs under the given name, safe to
+// call at any time, though models only pick up a new policy in UpdateSteerings
+func RegisterSteering(name string, factory SteeringFactory) {
+	steeringFactoriesLock.Lock()
+	defer steeringFactoriesLock.Unlock()
+	steeringFactories[name] = factory
+}
+
+// The steering policy a config asks for, classic if it does not say
+func NewSteering(config Config) (Steering, error) {
+	name := config.Steering
+	if name == "" {
+		name = ClassicSteering
+	}
+	steeringFactoriesLock.RLock()
+	factory, ok := steeringFactories[name]
+	steeringFactoriesLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown steering policy %q", name)
+	}
+	return factory(config), nil
+}
+
+// Resolve the steering policy of every species from its config, after the
+// configs' Steering or SteeringTemperature change outside of a timeline
+func (m *Model) UpdateSteerings() error {
+	steerings := make([]Steering, len(m.Configs))
+	for c, config := range m.Configs {
+		steering, err := NewSteering(config)
+		if err != nil {
+			return fmt.Errorf("species %d: %v", c, err)
+		}
+		steerings[c] = steering
+	}
+	m.steerings = steerings
+	return nil
+}
+
+type classicSteering struct{}
+
+func (classicSteering) Choose(rnd *rand.Rand, readings []float32) int {
+	if len(readings) != 3 {
+		return maxSteering{}.Choose(rnd, readings)
+	}
+	C, L, R := readings[0], readings[1], readings[2]
+	if C > L && C > R {
+		return 0
+	} else if C < L && C < R {
+		return 1 + int(rnd.Int63()&1)
+	} else if L < R {
+		return 2
+	} else if R < L {
+		return 1
+	}
+	return 0
+}
+
+type maxSteering struct{}
+
+func (maxSteering) Choose(rnd *rand.Rand, readings []float32) int {
+	best := 0
+	for i, value := range readings {
+		if value > readings[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+type weightedSteering struct{}
+
+func (weightedSteering) Choose(rnd *rand.Rand, readings []float32) int {
+	if len(readings) < 3 {
+		return maxSteering{}.Choose(rnd, readings)
+	}
+
+	// Weakest, second strongest and strongest of the first three sensors
+	W := [3]float32{readings[0], readings[1], readings[2]}
+	D := [3]int{0, 1, 2}
+	if W[0] > W[1] {
+		W[0], W[1] = W[1], W[0]
+		D[0], D[1] = D[1], D[0]
+	}
+	if W[0] > W[2] {
+		W[0], W[2] = W[2], W[0]
+		D[0], D[2] = D[2], D[0]
+	}
+	if W[1] > W[2] {
+		W[1], W[2] = W[2], W[1]
+		D[1], D[2] = D[2], D[1]
+	}
+
+	// Any other sensors replace the weakest or move up the order
+	for i := 3; i < len(readings); i++ {
+		value := readings[i]
+		switch {
+		case value > W[2]:
+			W[0], W[1], W[2] = W[1], W[2], value
+			D[0], D[1], D[2] = D[1], D[2], i
+		case value > W[1]:
+			W[0], W[1] = W[1], value
+			D[0], D[1] = D[1], i
+		case value < W[0]:
+			W[0] = value
+			D[0] = i
+		}
+	}
+
+	a := W[1] - W[0]
+	b := W[2] - W[1]
+	if rnd.Float32()*(a+b) < a {
+		return D[1]
+	}
+	return D[2]
+}
+
+type softmaxSteering struct {
+	temperature float32
+}
+
+func (s softmaxSteering) Choose(rnd *rand.Rand, readings []float32) int {
+	// Subtract the maximum so the exponentials can not overflow
+	max := readings[0]
+	for _, value := range readings {
+		if value > max {
+			max = value
+		}
+	}
+	var total float64
+	for _, value := range readings {
+		total += math.Exp(float64((value - max) / s.temperature))
+	}
+	t := rnd.Float64() * total
+	for i, value := range readings {
+		t -= math.Exp(float64((value - max) / s.temperature))
+		if t < 0 {
+			return i
+		}
+	}
+	return len(readings) - 1
+}
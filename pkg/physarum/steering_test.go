@@ -0,0 +1,108 @@
+package physarum
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSteeringPolicies(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	cases := []struct {
+		steering string
+		readings []float32
+		want     []int // Acceptable choices
+	}{
+		{ClassicSteering, []float32{3, 1, 2}, []int{0}},
+		{ClassicSteering, []float32{2, 3, 1}, []int{1}},
+		{ClassicSteering, []float32{2, 1, 3}, []int{2}},
+		{ClassicSteering, []float32{0, 2, 2}, []int{1, 2}},
+		{MaxSteering, []float32{1, 3, 2}, []int{1}},
+		{MaxSteering, []float32{2, 1, 1}, []int{0}},
+		{WeightedSteering, []float32{1, 3, 2}, []int{1, 2}},
+		{SoftmaxSteering, []float32{1, 2, 30}, []int{2}},
+		{ClassicSteering, []float32{1, 2, 5, 3, 0}, []int{2}},
+		{WeightedSteering, []float32{1, 4, 0, 5, 3}, []int{1, 3}},
+		{SoftmaxSteering, []float32{1, 2, 3, 30, 4}, []int{3}},
+	}
+	for _, c := range cases {
+		steering, err := NewSteering(Config{Steering: c.steering})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			got := steering.Choose(rnd, c.readings)
+			ok := false
+			for _, want := range c.want {
+				ok = ok || got == want
+			}
+			if !ok {
+				t.Fatalf("%s.Choose(%v) = %v, want one of %v", c.steering, c.readings, got, c.want)
+			}
+		}
+	}
+
+	if _, err := NewSteering(Config{Steering: "nope"}); err == nil {
+		t.Fatal("expected an error for an unknown steering policy")
+	}
+}
+
+func TestUpdateSteerings(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	m := NewModel(16, 16, 10, 1, 2, 1, RandomConfigs(rnd, 2), RandomAttractionTable(rnd, 2), Random, Toroidal, nil, 1)
+	m.Configs[1].Steering = "nope"
+	if err := m.UpdateSteerings(); err == nil {
+		t.Fatal("expected an error for an unknown steering policy")
+	}
+
+	m.Configs[1].Steering = SoftmaxSteering
+	if err := m.UpdateSteerings(); err != nil {
+		t.Fatal(err)
+	}
+	err := m.SetTimeline([]Keyframe{
+		{Iteration: 0, Values: map[string]float32{"Configs[1].SteeringTemperature": 2}},
+		{Iteration: 10, Values: map[string]float32{"Configs[1].SteeringTemperature": 4}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		m.Step()
+	}
+	if got := m.steerings[1].(softmaxSteering).temperature; got != 3 {
+		t.Fatalf("animated temperature: got %v, want 3", got)
+	}
+}
+
+func TestSensorLayout(t *testing.T) {
+	config := Config{SensorAngle: 0.5, SensorDistance: 9, RotationAngle: 0.25}
+	want := []Sensor{{0, 9, 0}, {-0.5, 9, -0.25}, {0.5, 9, 0.25}}
+	for i, sensor := range config.SensorLayout() {
+		if sensor != want[i] {
+			t.Fatalf("default sensor %d = %v, want %v", i, sensor, want[i])
+		}
+	}
+
+	config.Sensors = []Sensor{{Angle: 3, Distance: 4}, {Angle: -1, Distance: 20, Turn: -1.5}}
+	want = []Sensor{{3, 4, 0.25}, {-1, 20, -1.5}}
+	for i, sensor := range config.SensorLayout() {
+		if sensor != want[i] {
+			t.Fatalf("custom sensor %d = %v, want %v", i, sensor, want[i])
+		}
+	}
+
+	// Negative angles keep turning the way rotationAngle * direction did
+	config = Config{SensorAngle: -0.5, SensorDistance: 9, RotationAngle: -0.25}
+	want = []Sensor{{0, 9, 0}, {0.5, 9, 0.25}, {-0.5, 9, -0.25}}
+	for i, sensor := range config.SensorLayout() {
+		if sensor != want[i] {
+			t.Fatalf("negative sensor %d = %v, want %v", i, sensor, want[i])
+		}
+	}
+	config.Sensors = []Sensor{{Angle: 0, Distance: 4}, {Angle: 1, Distance: 4}, {Angle: -1, Distance: 4}}
+	want = []Sensor{{0, 4, 0}, {1, 4, -0.25}, {-1, 4, 0.25}}
+	for i, sensor := range config.SensorLayout() {
+		if sensor != want[i] {
+			t.Fatalf("custom sensor with negative rotation %d = %v, want %v", i, sensor, want[i])
+		}
+	}
+}
@@ -75,8 +75,8 @@ func (t *Texture) SetPalette(palette Palette, gamma float32) {
 	palette.Print()
 }
 
-func (t *Texture) ShufflePalette() {
-	rand.Shuffle(len(t.r), func(i, j int) {
+func (t *Texture) ShufflePalette(rnd *rand.Rand) {
+	rnd.Shuffle(len(t.r), func(i, j int) {
 		t.r[i], t.r[j] = t.r[j], t.r[i]
 		t.g[i], t.g[j] = t.g[j], t.g[i]
 		t.b[i], t.b[j] = t.b[j], t.b[i]
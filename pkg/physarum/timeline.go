@@ -0,0 +1,227 @@
+package physarum
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// All the supported easings between keyframes
+const (
+	EaseLinear = "linear"      // Constant speed
+	EaseStep   = "step"        // Hold the previous value, then jump at the keyframe
+	EaseIn     = "ease_in"     // Start slow
+	EaseOut    = "ease_out"    // End slow
+	EaseInOut  = "ease_in_out" // Start and end slow
+)
+
+// Parameter values to reach at an iteration. Values are keyed by parameter:
+//
+//	"ZoomFactor", "BlurRadius", "BlurPasses", "BlurSigma", "DiffusionRate"
+//	"BlurRadiusX", "BlurRadiusY", "ConversionThreshold"
+//	"Configs[2].SensorDistance"   any number field of a config, angles in radians
+//	"AttractionTable[0][1]"
+//	"ConversionTable[1][0]"
+//
+// Each parameter is animated between the keyframes that mention it, and held
+// before the first and after the last of them.
+type Keyframe struct {
+	Iteration int
+	Easing    string // How to get here from the previous keyframe, linear if empty
+	Values    map[string]float32
+}
+
+// The keyframes of one parameter, sorted by iteration
+type track struct {
+	set       func(m *Model, value float32)
+	keyframes []trackKey
+}
+
+type trackKey struct {
+	iteration int
+	value     float32
+	easing    func(t float64) float64
+}
+
+var easings = map[string]func(t float64) float64{
+	"":         func(t float64) float64 { return t },
+	EaseLinear: func(t float64) float64 { return t },
+	EaseStep:   func(t float64) float64 { return 0 },
+	EaseIn:     func(t float64) float64 { return t * t },
+	EaseOut: func(t float64) float64 {
+		return 1 - (1-t)*(1-t)
+	},
+	EaseInOut: func(t float64) float64 {
+		return t * t * (3 - 2*t)
+	},
+}
+
+var (
+	configKeyPattern = regexp.MustCompile(`^Configs\[(\d+)\]\.(\w+)$`)
+	tableKeyPattern  = regexp.MustCompile(`^(AttractionTable|ConversionTable)\[(\d+)\]\[(\d+)\]$`)
+)
+
+// Animate parameters of the model over the iterations, every Step applies the
+// keyframes before it moves the particles
+func (m *Model) SetTimeline(keyframes []Keyframe) error {
+	tracks := map[string]*track{}
+	for _, keyframe := range keyframes {
+		easing, ok := easings[keyframe.Easing]
+		if !ok {
+			return fmt.Errorf("unknown easing %q at iteration %d", keyframe.Easing, keyframe.Iteration)
+		}
+		for key, value := range keyframe.Values {
+			t, ok := tracks[key]
+			if !ok {
+				set, err := m.parameterSetter(key)
+				if err != nil {
+					return err
+				}
+				t = &track{set: set}
+				tracks[key] = t
+			}
+			t.keyframes = append(t.keyframes, trackKey{keyframe.Iteration, value, easing})
+		}
+	}
+
+	// Sorted for a stable order of application
+	keys := make([]string, 0, len(tracks))
+	for key := range tracks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	m.timeline = make([]*track, len(keys))
+	for i, key := range keys {
+		t := tracks[key]
+		sort.SliceStable(t.keyframes, func(a, b int) bool {
+			return t.keyframes[a].iteration < t.keyframes[b].iteration
+		})
+		m.timeline[i] = t
+	}
+
+	// The model gets its own copies to animate, so the settings they came from are left alone
+	if len(keyframes) > 0 {
+		m.Configs = append([]Config(nil), m.Configs...)
+		m.AttractionTable = copyTable(m.AttractionTable)
+		m.ConversionTable = copyTable(m.ConversionTable)
+	}
+	m.Keyframes = keyframes
+	return nil
+}
+
+// Set every animated parameter to its value at the current iteration
+func (m *Model) applyTimeline() {
+	for _, t := range m.timeline {
+		t.set(m, t.valueAt(m.Iteration))
+	}
+}
+
+func (t *track) valueAt(iteration int) float32 {
+	keys := t.keyframes
+	next := sort.Search(len(keys), func(i int) bool { return keys[i].iteration > iteration })
+	if next == 0 {
+		return keys[0].value
+	}
+	if next == len(keys) {
+		return keys[len(keys)-1].value
+	}
+	a, b := keys[next-1], keys[next]
+	f := b.easing(float64(iteration-a.iteration) / float64(b.iteration-a.iteration))
+	return a.value + (b.value-a.value)*float32(f)
+}
+
+// A function that sets the parameter a timeline key refers to
+func (m *Model) parameterSetter(key string) (func(m *Model, value float32), error) {
+	switch key {
+	case "ZoomFactor":
+		return func(m *Model, value float32) { m.ZoomFactor = value }, nil
+	case "BlurRadius":
+		return func(m *Model, value float32) { m.BlurRadius = int(math.Round(float64(value))) }, nil
+	case "BlurPasses":
+		return func(m *Model, value float32) { m.BlurPasses = int(math.Round(float64(value))) }, nil
+	case "BlurSigma":
+		return func(m *Model, value float32) { m.BlurSigma = value }, nil
+	case "DiffusionRate":
+		return func(m *Model, value float32) { m.DiffusionRate = value }, nil
+	case "BlurRadiusX":
+		return func(m *Model, value float32) { m.BlurRadiusX = int(math.Round(float64(value))) }, nil
+	case "BlurRadiusY":
+		return func(m *Model, value float32) { m.BlurRadiusY = int(math.Round(float64(value))) }, nil
+	case "ConversionThreshold":
+		return func(m *Model, value float32) { m.ConversionThreshold = value }, nil
+	}
+
+	if match := configKeyPattern.FindStringSubmatch(key); match != nil {
+		c, _ := strconv.Atoi(match[1])
+		if c >= len(m.Configs) {
+			return nil, fmt.Errorf("timeline key %q refers to species %d, but there are only %d", key, c, len(m.Configs))
+		}
+		field, ok := reflect.TypeOf(Config{}).FieldByName(match[2])
+		if !ok {
+			return nil, fmt.Errorf("timeline key %q refers to an unknown config field", key)
+		}
+		kind := field.Type.Kind()
+		optional := kind == reflect.Ptr
+		if optional {
+			kind = field.Type.Elem().Kind()
+		}
+		if kind != reflect.Float32 && kind != reflect.Int {
+			return nil, fmt.Errorf("timeline key %q refers to a config field that is not a number", key)
+		}
+		return func(m *Model, value float32) {
+			f := reflect.ValueOf(&m.Configs[c]).Elem().FieldByIndex(field.Index)
+			if optional {
+				// A new value of its own, instead of writing through a
+				// pointer that copies of the config may share
+				f.Set(reflect.New(field.Type.Elem()))
+				f = f.Elem()
+			}
+			if kind == reflect.Float32 {
+				f.SetFloat(float64(value))
+			} else {
+				f.SetInt(int64(math.Round(float64(value))))
+			}
+			m.refreshSteering(c)
+		}, nil
+	}
+
+	if match := tableKeyPattern.FindStringSubmatch(key); match != nil {
+		i, _ := strconv.Atoi(match[2])
+		j, _ := strconv.Atoi(match[3])
+		table := m.AttractionTable
+		if match[1] == "ConversionTable" {
+			table = m.ConversionTable
+		}
+		if i >= len(table) || j >= len(table[i]) {
+			return nil, fmt.Errorf("timeline key %q is outside of the table", key)
+		}
+		if match[1] == "ConversionTable" {
+			return func(m *Model, value float32) { m.ConversionTable[i][j] = value }, nil
+		}
+		return func(m *Model, value float32) { m.AttractionTable[i][j] = value }, nil
+	}
+
+	return nil, fmt.Errorf("unknown timeline key %q", key)
+}
+
+// Rebuild the steering of species c from its animated config. The policy
+// name can not be animated and was resolved already, so this can not fail.
+func (m *Model) refreshSteering(c int) {
+	if steering, err := NewSteering(m.Configs[c]); err == nil && c < len(m.steerings) {
+		m.steerings[c] = steering
+	}
+}
+
+func copyTable(table [][]float32) [][]float32 {
+	if table == nil {
+		return nil
+	}
+	result := make([][]float32, len(table))
+	for i, row := range table {
+		result[i] = append([]float32(nil), row...)
+	}
+	return result
+}
@@ -0,0 +1,53 @@
+package physarum
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestTimeline(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	configs := RandomConfigs(rnd, 2)
+	table := RandomAttractionTable(rnd, 2)
+	m := NewModel(64, 64, 100, 1, 2, 1, configs, table, RandomCircleIn, Toroidal, nil, 1)
+	err := m.SetTimeline([]Keyframe{
+		{Iteration: 10, Values: map[string]float32{"Configs[1].StepDistance": 1, "AttractionTable[0][1]": 2}},
+		{Iteration: 20, Values: map[string]float32{"Configs[1].StepDistance": 3}},
+		{Iteration: 30, Easing: EaseStep, Values: map[string]float32{"AttractionTable[0][1]": 4}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		iteration  int
+		step, attr float32
+	}{
+		{0, 1, 2},
+		{10, 1, 2},
+		{15, 2, 2},
+		{20, 3, 2},
+		{29, 3, 2},
+		{30, 3, 4},
+		{99, 3, 4},
+	}
+	for _, test := range tests {
+		m.Iteration = test.iteration
+		m.applyTimeline()
+		if got := m.Configs[1].StepDistance; got != test.step {
+			t.Errorf("iteration %d: StepDistance = %v, want %v", test.iteration, got, test.step)
+		}
+		if got := m.AttractionTable[0][1]; got != test.attr {
+			t.Errorf("iteration %d: AttractionTable[0][1] = %v, want %v", test.iteration, got, test.attr)
+		}
+	}
+	if configs[1].StepDistance == m.Configs[1].StepDistance || table[0][1] == m.AttractionTable[0][1] {
+		t.Error("timeline changed the configs it was given")
+	}
+
+	for _, key := range []string{"Configs[2].StepDistance", "Configs[0].Steering", "AttractionTable[0][5]", "Speed"} {
+		if err := m.SetTimeline([]Keyframe{{Values: map[string]float32{key: 1}}}); err == nil {
+			t.Errorf("%s: expected an error", key)
+		}
+	}
+}